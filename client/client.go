@@ -0,0 +1,391 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+)
+
+const DEFAULT_BATCH_SIZE = 100
+const DEFAULT_FLUSH_INTERVAL = time.Second
+const DEFAULT_QUEUE_SIZE = 10_000
+const DEFAULT_MAX_RETRIES = 5
+const DEFAULT_RETRY_BACKOFF = 500 * time.Millisecond
+const DEFAULT_MAX_RETRY_BACKOFF = 30 * time.Second
+
+// DropPolicy decides what happens to a message logged when the queue is full
+type DropPolicy int
+
+// The message being logged is dropped
+const DROP_NEWEST DropPolicy = 0
+
+// The oldest message in the queue is dropped to make room for the message being logged
+const DROP_OLDEST DropPolicy = 1
+
+// Logging blocks until there is room in the queue or the client is closed
+const BLOCK DropPolicy = 2
+
+var ErrClosed = errors.New("logdy client has been closed")
+
+type Fields = models.Fields
+type LogOptions = models.LogOptions
+
+type Config struct {
+	// A URL of Logdy including its HttpPathPrefix, e.g. http://logs.internal:8080/
+	Url string
+
+	// Key of the REST API of Logdy (its ApiKey)
+	ApiKey string
+
+	// A source of messages presented in the UI, e.g. a name of the service
+	Source string
+
+	// Messages are sent once a batch is full or the flush interval passes
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// A number of messages waiting to be sent, further messages are handled with DropPolicy
+	QueueSize  int
+	DropPolicy DropPolicy
+
+	// A batch is retried on network errors, 429 and 5xx responses with a backoff doubling
+	// from RetryBackoff up to MaxRetryBackoff, negative MaxRetries disables retries
+	MaxRetries      int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// Whether batches are compressed with gzip
+	Gzip bool
+
+	// http.DefaultClient is used when nil
+	HttpClient *http.Client
+
+	// Invoked with an error when a batch of messages couldn't be delivered
+	OnError func(err error, count int)
+}
+
+type logItem struct {
+	Ts     string            `json:"ts"`
+	Log    json.RawMessage   `json:"log"`
+	Source string            `json:"source,omitempty"`
+	Level  string            `json:"level,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type logRequest struct {
+	Logs   []logItem `json:"logs"`
+	Source string    `json:"source"`
+}
+
+// Client sends messages in batches to the REST API (api/log) of a remote Logdy,
+// it implements logdy.Sink so it can be used with the adapters of the logdy package,
+// e.g. slog.New(logdy.NewSlogHandler(c, nil)), and io.Writer with a message per line
+type Client struct {
+	config Config
+	url    string
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan logItem
+
+	// closed before Close takes the lock so logging blocked on a full queue gives up
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	dropped atomic.Int64
+
+	// cancels retries when Close runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a client and starts sending messages in the background, Close flushes messages left in the queue
+func New(config Config) (*Client, error) {
+	if config.Url == "" {
+		return nil, errors.New("missing url of logdy")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DEFAULT_BATCH_SIZE
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DEFAULT_FLUSH_INTERVAL
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DEFAULT_QUEUE_SIZE
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DEFAULT_MAX_RETRIES
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DEFAULT_RETRY_BACKOFF
+	}
+	if config.MaxRetryBackoff <= 0 {
+		config.MaxRetryBackoff = DEFAULT_MAX_RETRY_BACKOFF
+	}
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		config:  config,
+		url:     strings.TrimSuffix(config.Url, "/") + "/api/log",
+		queue:   make(chan logItem, config.QueueSize),
+		closing: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go c.run()
+
+	return c, nil
+}
+
+func (c *Client) Log(fields Fields) error {
+	return c.LogWithOptions(fields, LogOptions{})
+}
+
+func (c *Client) LogWithOptions(fields Fields, opts LogOptions) error {
+	serialized, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return c.enqueue(serialized, opts)
+}
+
+func (c *Client) LogString(message string) error {
+	return c.LogStringWithOptions(message, LogOptions{})
+}
+
+// LogStringWithOptions queues a message, the type of the message in options is not sent
+func (c *Client) LogStringWithOptions(message string, opts LogOptions) error {
+	// lines which are not JSON are sent as JSON strings
+	if !json.Valid([]byte(message)) {
+		serialized, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		return c.enqueue(serialized, opts)
+	}
+
+	return c.enqueue(json.RawMessage(message), opts)
+}
+
+// Write queues each non-empty line as a message, e.g. log.SetOutput(c)
+func (c *Client) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := c.LogStringWithOptions(string(line), LogOptions{}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns a number of messages dropped because the queue was full or they couldn't be delivered
+func (c *Client) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// Close stops accepting messages and sends messages left in the queue, messages which couldn't
+// be sent before the context is done are dropped
+func (c *Client) Close(ctx context.Context) error {
+	c.closingOnce.Do(func() { close(c.closing) })
+
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		c.cancel()
+		<-c.done
+		return ctx.Err()
+	}
+}
+
+func (c *Client) enqueue(log json.RawMessage, opts LogOptions) error {
+	ts := opts.Ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	item := logItem{
+		Ts:     ts.Format(time.RFC3339Nano),
+		Log:    log,
+		Source: opts.Source,
+		Level:  opts.Level,
+		Labels: opts.Labels,
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	switch c.config.DropPolicy {
+	case BLOCK:
+		// the queue isn't closed while the read lock is held, a send blocked
+		// on a full queue gives up when Close starts so it can take the lock
+		select {
+		case c.queue <- item:
+		case <-c.closing:
+			return ErrClosed
+		}
+	case DROP_OLDEST:
+		for {
+			select {
+			case c.queue <- item:
+				return nil
+			default:
+			}
+
+			select {
+			case <-c.queue:
+				c.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case c.queue <- item:
+		default:
+			c.dropped.Add(1)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]logItem, 0, c.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := c.send(batch); err != nil {
+			c.dropped.Add(int64(len(batch)))
+			if c.config.OnError != nil {
+				c.config.OnError(err, len(batch))
+			}
+		}
+		batch = make([]logItem, 0, c.config.BatchSize)
+	}
+
+	for {
+		select {
+		case item, ok := <-c.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= c.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send delivers a batch retrying on failures which may be temporary
+func (c *Client) send(batch []logItem) error {
+	body, err := c.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	backoff := c.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(body)
+		if err == nil || !retry || attempt >= c.config.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return errors.Join(err, c.ctx.Err())
+		}
+		backoff = min(backoff*2, c.config.MaxRetryBackoff)
+	}
+}
+
+func (c *Client) encode(batch []logItem) ([]byte, error) {
+	serialized, err := json.Marshal(logRequest{Logs: batch, Source: c.config.Source})
+	if err != nil {
+		return nil, err
+	}
+	if !c.config.Gzip {
+		return serialized, nil
+	}
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(serialized); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// post sends a request once, returns whether it should be retried when it fails
+func (c *Client) post(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.ApiKey)
+	if c.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := c.config.HttpClient.Do(req)
+	if err != nil {
+		return c.ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	err = fmt.Errorf("logdy responded with %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
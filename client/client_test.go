@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logdyhttp "github.com/logdyhq/logdy-core/http"
+	"github.com/logdyhq/logdy-core/logdy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSendsToLogdy(t *testing.T) {
+	i := logdyhttp.NewInstance(logdyhttp.Config{HttpPathPrefix: "_logdy-ui", ApiKey: "secret"})
+	server := httptest.NewServer(i.Handler(logdyhttp.HandlerOptions{}))
+	defer server.Close()
+
+	c, err := New(Config{
+		Url:       server.URL + "/_logdy-ui",
+		ApiKey:    "secret",
+		Source:    "users-service",
+		BatchSize: 2,
+		Gzip:      true,
+	})
+	assert.Nil(t, err)
+
+	slog.New(logdy.NewSlogHandler(c, nil)).Error("failed", "user", "john")
+	c.LogWithOptions(Fields{"foo": "bar"}, LogOptions{Source: "billing-job", Labels: map[string]string{"tenant": "acme"}})
+	io.WriteString(c, "plain text\n\n")
+
+	assert.Nil(t, c.Close(context.Background()))
+	assert.Equal(t, ErrClosed, c.LogString("too late"))
+	time.Sleep(10 * time.Millisecond)
+
+	msgs := i.Clients.Query(logdyhttp.QueryOptions{})
+	assert.Equal(t, 3, len(msgs))
+	assert.Regexp(t, `"msg":"failed","user":"john"`, msgs[0].Content)
+	assert.Equal(t, "error", msgs[0].Level)
+	assert.Equal(t, "users-service", msgs[0].Origin.ApiSource)
+	assert.Equal(t, `{"foo":"bar"}`, msgs[1].Content)
+	assert.Equal(t, "billing-job", msgs[1].Origin.ApiSource)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, msgs[1].Origin.Labels)
+	assert.Equal(t, "plain text", msgs[2].Content)
+	assert.Equal(t, int64(0), c.Dropped())
+}
+
+func TestClientRetries(t *testing.T) {
+	attempts := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/invalid/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c, _ := New(Config{Url: server.URL, RetryBackoff: time.Millisecond})
+	c.LogString("foo")
+	assert.Nil(t, c.Close(context.Background()))
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Equal(t, int64(0), c.Dropped())
+
+	failed := 0
+	c, _ = New(Config{Url: server.URL + "/invalid", RetryBackoff: time.Millisecond, OnError: func(err error, count int) {
+		failed += count
+	}})
+	c.LogString("foo")
+	assert.Nil(t, c.Close(context.Background()))
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, int64(1), c.Dropped())
+}
+
+func TestClientDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy   DropPolicy
+		expected []string
+	}{
+		{DROP_NEWEST, []string{"1", "2"}},
+		{DROP_OLDEST, []string{"1", "3"}},
+	}
+
+	for _, tt := range tests {
+		received := make(chan string, 10)
+		requested := make(chan struct{}, 10)
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested <- struct{}{}
+			<-release
+
+			req := logRequest{}
+			json.NewDecoder(r.Body).Decode(&req)
+			for _, item := range req.Logs {
+				received <- string(item.Log)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		c, _ := New(Config{Url: server.URL, BatchSize: 1, QueueSize: 1, DropPolicy: tt.policy})
+		c.Log(Fields{"id": "1"})
+		// the first message is being sent, the second one waits in the queue
+		<-requested
+		c.Log(Fields{"id": "2"})
+		c.Log(Fields{"id": "3"})
+		close(release)
+
+		assert.Nil(t, c.Close(context.Background()))
+		close(received)
+		ids := []string{}
+		for msg := range received {
+			fields := Fields{}
+			json.Unmarshal([]byte(msg), &fields)
+			ids = append(ids, fields["id"].(string))
+		}
+		assert.Equal(t, tt.expected, ids)
+		assert.Equal(t, int64(1), c.Dropped())
+		server.Close()
+	}
+}
+
+func TestClientCloseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c, _ := New(Config{Url: server.URL, RetryBackoff: time.Hour})
+	c.LogString("foo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.Close(ctx))
+	assert.Equal(t, int64(1), c.Dropped())
+}
+
+func TestClientCloseWhileBlocked(t *testing.T) {
+	requested := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c, _ := New(Config{Url: server.URL, BatchSize: 1, QueueSize: 1, DropPolicy: BLOCK, RetryBackoff: time.Hour})
+	c.LogString("1")
+	// the first message is being retried, the second one fills the queue
+	<-requested
+	c.LogString("2")
+
+	blocked := make(chan error)
+	go func() {
+		blocked <- c.LogString("3")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.Close(ctx))
+	assert.Equal(t, ErrClosed, <-blocked)
+	assert.Equal(t, int64(2), c.Dropped())
+}
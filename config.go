@@ -4,7 +4,6 @@ import (
 	"os"
 
 	"github.com/logdyhq/logdy-core/http"
-	"github.com/logdyhq/logdy-core/modes"
 	"github.com/spf13/cobra"
 )
 
@@ -113,6 +112,6 @@ func parseConfig(cmd *cobra.Command) {
 
 	config.AppendToFileRaw = getBoolCfgVal("append-to-file-raw", cmd)
 	config.AnalyticsDisabled = getBoolCfgVal("no-analytics", cmd)
-	modes.FallthroughGlobal = getBoolCfgVal("fallthrough", cmd)
-	modes.DisableANSICodeStripping = getBoolCfgVal("disable-ansi-code-stripping", cmd)
+	config.Fallthrough = getBoolCfgVal("fallthrough", cmd)
+	config.DisableANSICodeStripping = getBoolCfgVal("disable-ansi-code-stripping", cmd)
 }
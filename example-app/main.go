@@ -6,7 +6,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/logdyhq/logdy-core/logdy"
@@ -24,6 +23,9 @@ func main() {
 	case "without-webserver":
 		// go run main.go without-webserver
 		exampleWithoutWebserver()
+	case "with-handler":
+		// go run main.go with-handler
+		exampleWithHandler()
 	}
 }
 
@@ -37,7 +39,7 @@ func exampleWithoutWebserver() {
 		LogInterceptor: func(entry *logdy.LogEntry) {
 			log.Println("Logdy internal log message intercepted", entry.Message, entry.Data, entry.Time)
 		},
-	}, nil)
+	}, nil).(logdy.Extended)
 
 	go func() {
 		for {
@@ -46,6 +48,12 @@ func exampleWithoutWebserver() {
 				"time": time.Now(),
 			})
 			logdyLogger.LogString("This is just a string " + time.Now().String())
+			logdyLogger.LogStringWithOptions("Background job finished", logdy.LogOptions{
+				Type:   logdy.MessageTypeStderr,
+				Source: "cleanup-job",
+				Labels: map[string]string{"queue": "default"},
+				Level:  "warn",
+			})
 			time.Sleep(1000 * time.Millisecond)
 		}
 	}()
@@ -72,37 +80,16 @@ func exampleWithWebserver() {
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
-// Logger is a middleware handler that does request logging
-type Logger struct {
-	logdy   logdy.Logdy
-	handler http.Handler
-}
-
-// ServeHTTP handles the request by passing it to the real
-// handler and logging the request details
-func (l *Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-
-	l.handler.ServeHTTP(w, r)
-
-	// If this is a request to Logdy backend, ignore it
-	if strings.HasPrefix(r.URL.Path, l.logdy.Config().HttpPathPrefix) {
-		return
-	}
-
-	l.logdy.Log(logdy.Fields{
-		"ua":     r.Header.Get("user-agent"),
-		"method": r.Method,
-		"path":   r.URL.Path,
-		"query":  r.URL.RawQuery,
-		"time":   time.Since(start),
-	})
-}
-
 func exampleWithServeMux() {
 
 	mux := http.NewServeMux()
+	var logger logdy.Extended
 	mux.HandleFunc("/v1/hello", func(w http.ResponseWriter, r *http.Request) {
+		// the request id correlates this message with the request logged by the middleware
+		logger.Log(logdy.Fields{
+			"msg":        "saying hello",
+			"request_id": logdy.RequestIdFromContext(r.Context()),
+		})
 		w.Write([]byte("Hello, World!"))
 	})
 	mux.HandleFunc("/v1/time", func(w http.ResponseWriter, r *http.Request) {
@@ -110,12 +97,45 @@ func exampleWithServeMux() {
 		w.Write([]byte(fmt.Sprintf("the current time is %v", curTime)))
 	})
 
-	logger := logdy.InitializeLogdy(logdy.Config{
+	logger = logdy.InitializeLogdy(logdy.Config{
 		HttpPathPrefix: "/_logdy-ui",
 		LogLevel:       logdy.LOG_LEVEL_NORMAL,
-	}, mux)
+	}, mux).(logdy.Extended)
 
 	addr := ":8082"
 	log.Printf("server is listening at %s", addr)
-	log.Fatal(http.ListenAndServe(addr, &Logger{logdy: logger, handler: mux}))
+	log.Fatal(http.ListenAndServe(addr, logdy.Middleware(logger, logdy.MiddlewareOptions{LogRequestBody: true})(mux)))
+}
+
+func exampleWithHandler() {
+	logger := logdy.New(logdy.Config{
+		HttpPathPrefix: "/_logdy-ui",
+		LogLevel:       logdy.LOG_LEVEL_NORMAL,
+	})
+
+	basicAuth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "admin" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="logdy"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/hello", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log(logdy.Fields{"msg": "saying hello"})
+		w.Write([]byte("Hello, World!"))
+	})
+	// the UI is behind the authentication of the app and can't save its config on the server
+	mux.Handle("/_logdy-ui/", logger.Handler(logdy.HandlerOptions{
+		Middleware:        []func(http.Handler) http.Handler{basicAuth},
+		DisabledEndpoints: []string{logdy.ENDPOINT_CONFIG_SAVE},
+	}))
+
+	addr := ":8083"
+	log.Printf("server is listening at %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
 }
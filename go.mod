@@ -3,23 +3,26 @@ module github.com/logdyhq/logdy-core
 go 1.23.2
 
 require (
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/gorilla/websocket v1.5.1
+	github.com/klauspost/compress v1.18.0
+	github.com/nxadm/tail v1.4.11
 	github.com/spf13/cobra v1.8.0
 	github.com/valyala/fastjson v1.6.4
+	go.uber.org/zap v1.27.0
+	golang.org/x/sys v0.16.0
 )
 
 require (
 	github.com/VividCortex/ewma v1.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/color v1.15.0 // indirect
-	github.com/fsnotify/fsnotify v1.6.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
-	github.com/nxadm/tail v1.4.11 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
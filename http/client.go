@@ -1,7 +1,7 @@
 package http
 
 import (
-	"fmt"
+	"context"
 	"sync"
 	"time"
 
@@ -12,10 +12,19 @@ import (
 	. "github.com/logdyhq/logdy-core/models"
 )
 
+// a default time window during which messages are gathered and sent to a client in a bulk
+const DEFAULT_BULK_WINDOW_MS int64 = 100
+
+// Deprecated: use Instance.Ch, Ch is a channel of the default instance created by InitializeClients
 var Ch chan models.Message
+
+// Deprecated: use Instance.Clients, Clients are clients of the default instance created by InitializeClients
 var Clients *ClientsStruct
 
-var BULK_WINDOW_MS int64 = 100
+// Deprecated: use Config.BulkWindowMs, it's the bulk window of NewClient and of
+// the default instance when the config doesn't set one
+var BULK_WINDOW_MS int64 = DEFAULT_BULK_WINDOW_MS
+
 var FLUSH_BUFFER_SIZE = 1000
 
 type CursorStatus string
@@ -30,6 +39,8 @@ type Client struct {
 	ch         chan []Message
 	buffer     []Message
 
+	bulkWindowMs int64
+
 	cursorStatus   CursorStatus
 	cursorPosition string // last delivered message id
 }
@@ -58,6 +69,23 @@ func (c *Client) flushBuffer() {
 	}
 }
 
+// drainBuffer delivers messages left in the buffer without waiting for a client that no longer reads them
+func (c *Client) drainBuffer() {
+	c.bufferOpMu.Lock()
+	defer c.bufferOpMu.Unlock()
+
+	for i := 0; i < len(c.buffer); i += FLUSH_BUFFER_SIZE {
+		select {
+		case c.ch <- c.buffer[i:min(i+FLUSH_BUFFER_SIZE, len(c.buffer))]:
+		default:
+			utils.Logger.WithField("count", len(c.buffer)-i).Debug("Client: Dropping messages left in the buffer")
+			c.clearBuffer()
+			return
+		}
+	}
+	c.clearBuffer()
+}
+
 func (c *Client) clearBuffer() {
 	c.buffer = []Message{}
 }
@@ -77,12 +105,13 @@ func (c *Client) waitForBufferDrain() {
 // in a very short timespan
 func (c *Client) startBufferFlushLoop() {
 	for {
-		time.Sleep(time.Millisecond * time.Duration(BULK_WINDOW_MS))
+		time.Sleep(time.Millisecond * time.Duration(c.bulkWindowMs))
 		select {
 		case <-c.done:
 			utils.Logger.Debug("Client: received done signal, quitting")
 			defer close(c.done)
 			defer close(c.ch)
+			c.drainBuffer()
 			return
 		default:
 
@@ -103,11 +132,17 @@ func (c *Client) startBufferFlushLoop() {
 	}
 }
 
+// Deprecated: clients are created by ClientsStruct.Join
 func NewClient() *Client {
+	return newClient(BULK_WINDOW_MS)
+}
+
+func newClient(bulkWindowMs int64) *Client {
 	c := &Client{
 		bufferOpMu:     sync.Mutex{},
 		done:           make(chan struct{}),
-		ch:             make(chan []Message, BULK_WINDOW_MS*25),
+		ch:             make(chan []Message, bulkWindowMs*25),
+		bulkWindowMs:   bulkWindowMs,
 		cursorStatus:   CURSOR_STOPPED,
 		cursorPosition: "",
 		id:             utils.RandStringRunes(6),
@@ -126,18 +161,42 @@ type ClientsStruct struct {
 	ring               *ring.RingQueue[Message]
 	currentlyConnected int
 	stats              Stats
+	bulkWindowMs       int64
+
+	// guards the ring, messages are pushed by the delivery loop while handlers read them
+	ringMu sync.RWMutex
+
+	subsMu sync.Mutex
+	subs   map[*subscription]struct{}
+
+	// closed once all messages are delivered and clients are closed
+	stopped chan struct{}
+	// connections of clients (WebSockets) still being served
+	conns sync.WaitGroup
 }
 
 func NewClients(msgs <-chan Message, maxCount int64) *ClientsStruct {
+	return NewClientsWithBulkWindow(msgs, maxCount, DEFAULT_BULK_WINDOW_MS)
+}
+
+// NewClientsWithBulkWindow creates clients receiving messages in bulks gathered
+// during a given time window, DEFAULT_BULK_WINDOW_MS is used when it's not positive
+func NewClientsWithBulkWindow(msgs <-chan Message, maxCount int64, bulkWindowMs int64) *ClientsStruct {
 	if maxCount == 0 {
 		maxCount = 100_000
 	}
+	if bulkWindowMs <= 0 {
+		bulkWindowMs = DEFAULT_BULK_WINDOW_MS
+	}
 
 	cls := &ClientsStruct{
 		mu:                 sync.Mutex{},
 		mainChan:           msgs,
 		clients:            map[string]*Client{},
 		currentlyConnected: 0,
+		bulkWindowMs:       bulkWindowMs,
+		stopped:            make(chan struct{}),
+		subs:               map[*subscription]struct{}{},
 		ring:               ring.NewRingQueue[Message](maxCount),
 		stats: Stats{
 			MaxCount: maxCount,
@@ -165,6 +224,7 @@ func (c *ClientsStruct) Load(clientId string, startCount int, count int, include
 
 	seen := false
 	sent := 0
+	c.ringMu.RLock()
 	c.ring.Scan(func(msg Message, i int) bool {
 		if i+1 == startCount {
 			seen = true
@@ -186,6 +246,7 @@ func (c *ClientsStruct) Load(clientId string, startCount int, count int, include
 		}
 		return false
 	})
+	c.ringMu.RUnlock()
 
 	cl.flushBuffer()
 
@@ -194,6 +255,9 @@ func (c *ClientsStruct) Load(clientId string, startCount int, count int, include
 func (c *ClientsStruct) PeekLog(idxs []int) []Message {
 	msgs := []Message{}
 
+	c.ringMu.RLock()
+	defer c.ringMu.RUnlock()
+
 	for _, idx := range idxs {
 		if c.ring.Size()-1 < idx {
 			continue
@@ -220,6 +284,7 @@ func (c *ClientsStruct) ClientStats(clientId string) ClientStats {
 
 	stats.LastDeliveredId = cl.cursorPosition
 
+	c.ringMu.RLock()
 	c.ring.Scan(func(m Message, idx int) bool {
 		if m.Id == cl.cursorPosition {
 			stats.LastDeliveredIdIdx = idx
@@ -228,6 +293,7 @@ func (c *ClientsStruct) ClientStats(clientId string) ClientStats {
 
 		return false
 	})
+	c.ringMu.RUnlock()
 
 	stats.CountToTail = c.Stats().Count - stats.LastDeliveredIdIdx
 
@@ -240,6 +306,7 @@ func (c *ClientsStruct) ResumeFollowing(clientId string, sinceCursor bool) {
 	c.clients[clientId].bufferOpMu.Lock()
 	if sinceCursor {
 		seen := false
+		c.ringMu.RLock()
 		c.ring.Scan(func(msg Message, _ int) bool {
 			if msg.Id == c.clients[clientId].cursorPosition {
 				seen = true
@@ -253,6 +320,7 @@ func (c *ClientsStruct) ResumeFollowing(clientId string, sinceCursor bool) {
 			c.clients[clientId].handleMessage(msg, true)
 			return false
 		})
+		c.ringMu.RUnlock()
 
 	}
 	c.clients[clientId].flushBuffer()
@@ -265,7 +333,8 @@ func (c *ClientsStruct) PauseFollowing(clientId string) {
 	c.clients[clientId].waitForBufferDrain()
 }
 
-// starts a delivery channel to all clients
+// starts a delivery channel to all clients, once the channel is closed
+// remaining messages are delivered and all clients are closed
 func (c *ClientsStruct) Start() {
 	if c.started {
 		utils.Logger.Debug("Clients delivery loop already started")
@@ -273,13 +342,20 @@ func (c *ClientsStruct) Start() {
 	}
 
 	c.started = true
-	for {
-		msg := <-c.mainChan
+	defer close(c.stopped)
+	defer c.closeSubscriptions()
+	defer c.closeAll()
+
+	for msg := range c.mainChan {
 		if c.stats.FirstMessageAt.IsZero() {
 			c.stats.FirstMessageAt = time.Now()
 		}
 
+		c.ringMu.Lock()
 		c.ring.PushSafe(msg)
+		c.ringMu.Unlock()
+		c.publish(msg)
+
 		if c.stats.Count < int(c.stats.MaxCount) {
 			c.stats.Count++
 		}
@@ -295,16 +371,18 @@ func (c *ClientsStruct) Start() {
 }
 
 func (c *ClientsStruct) Join(tailLen int, shouldFollow bool) *Client {
-	cl := NewClient()
+	cl := newClient(c.bulkWindowMs)
 	c.clients[cl.id] = cl
 	c.currentlyConnected++
 
 	// deliver last N messages from a buffer upon connection
+	c.ringMu.RLock()
 	idx := 0
 	if c.ring.Size() > tailLen {
 		idx = c.ring.Size() - tailLen
 	}
 	sl, err := c.ring.PeekSlice(idx)
+	c.ringMu.RUnlock()
 
 	if err != nil {
 		panic(err)
@@ -320,6 +398,40 @@ func (c *ClientsStruct) Join(tailLen int, shouldFollow bool) *Client {
 	return c.clients[cl.id]
 }
 
+func (c *ClientsStruct) closeAll() {
+	c.mu.Lock()
+	ids := make([]string, 0, len(c.clients))
+	for id := range c.clients {
+		ids = append(ids, id)
+	}
+	c.mu.Unlock()
+
+	for _, id := range ids {
+		c.Close(id)
+	}
+}
+
+// Stopped is closed once the channel of messages is closed and all clients are closed
+func (c *ClientsStruct) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+// Wait waits until connections of all clients are closed or the context is done
+func (c *ClientsStruct) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (c *ClientsStruct) Close(id string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -334,6 +446,7 @@ func (c *ClientsStruct) Close(id string) {
 	c.currentlyConnected--
 }
 
+// Deprecated: use NewInstance, InitChannel creates a channel of the default instance
 func InitChannel() {
 	if Ch != nil {
 		return
@@ -342,24 +455,18 @@ func InitChannel() {
 	Ch = make(chan models.Message, 1000)
 }
 
+// Deprecated: use NewInstance, InitializeClients creates the default instance processing messages
+// produced to Ch, later calls return its clients
 func InitializeClients(config Config) *ClientsStruct {
 	if Clients != nil {
 		return Clients
 	}
 
-	bts := int64(0)
-
-	if config.AppendToFileRotateMaxSize != "" {
-		var err error
-		bts, err = utils.ParseRotateSize(config.AppendToFileRotateMaxSize)
-
-		if err != nil {
-			panic(fmt.Errorf("file rotate size parse error: %w", err))
-		}
+	InitChannel()
+	if config.BulkWindowMs <= 0 {
+		config.BulkWindowMs = BULK_WINDOW_MS
 	}
-
-	mainChan := utils.ProcessIncomingMessagesWithRotation(Ch, config.AppendToFile, config.AppendToFileRaw, bts, 1000)
-	Clients = NewClients(mainChan, config.MaxMessageCount)
+	Clients = newInstance(config, Ch).Clients
 
 	return Clients
 }
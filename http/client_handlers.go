@@ -11,27 +11,37 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/modes"
 	"github.com/logdyhq/logdy-core/utils"
 	"github.com/sirupsen/logrus"
 )
 
 const LOGDY_CONFIG_ENV_FILE = "logdy.config.json"
 
+// checkUiPassword verifies the password of the UI passed in the query,
+// a client with a wrong password is denied with 403
+func checkUiPassword(uiPass string, w http.ResponseWriter, r *http.Request) bool {
+	if uiPass == "" {
+		return true
+	}
+
+	pass := r.URL.Query().Get("password")
+	if pass == "" || uiPass != pass {
+		utils.Logger.WithFields(logrus.Fields{
+			"ip": r.RemoteAddr,
+			"ua": r.Header.Get("user-agent"),
+		}).Info("Client denied")
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
 func handleCheckPass(uiPass string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		utils.Logger.Debug("/api/check-pass")
-		pass := r.URL.Query().Get("password")
-		if uiPass == "" {
-			w.WriteHeader(200)
-			return
-		}
-
-		if pass == "" || uiPass != pass {
-			utils.Logger.WithFields(logrus.Fields{
-				"ip": r.RemoteAddr,
-				"ua": r.Header.Get("user-agent"),
-			}).Info("Client denied")
-			w.WriteHeader(http.StatusForbidden)
+		if !checkUiPassword(uiPass, w, r) {
 			return
 		}
 
@@ -86,16 +96,8 @@ func handleWs(uiPass string, clients *ClientsStruct) func(w http.ResponseWriter,
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		if uiPass != "" {
-			pass := r.URL.Query().Get("password")
-			if pass == "" || uiPass != pass {
-				utils.Logger.WithFields(logrus.Fields{
-					"ip": r.RemoteAddr,
-					"ua": r.Header.Get("user-agent"),
-				}).Info("Client denied")
-				w.WriteHeader(http.StatusForbidden)
-				return
-			}
+		if !checkUiPassword(uiPass, w, r) {
+			return
 		}
 
 		// Upgrade the HTTP connection to a WebSocket connection.
@@ -105,6 +107,9 @@ func handleWs(uiPass string, clients *ClientsStruct) func(w http.ResponseWriter,
 			return
 		}
 
+		clients.conns.Add(1)
+		defer clients.conns.Done()
+
 		utils.Logger.Info("New Web UI client connected")
 
 		ch := clients.Join(100, r.URL.Query().Get("should_follow") == "true")
@@ -177,7 +182,16 @@ func handleWs(uiPass string, clients *ClientsStruct) func(w http.ResponseWriter,
 		}(clientId)
 
 		for {
-			msgs := <-ch.ch
+			msgs, ok := <-ch.ch
+			if !ok {
+				// the client has been closed, e.g. the server is shutting down
+				mtx.Lock()
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+				mtx.Unlock()
+				conn.Close()
+				break
+			}
+
 			bulk := models.MessageBulk{
 				BaseMessage: models.BaseMessage{
 					MessageType: models.MessageTypeLogBulk,
@@ -241,6 +255,22 @@ func handleWs(uiPass string, clients *ClientsStruct) func(w http.ResponseWriter,
 	}
 }
 
+func handleFilesStatus(uiPass string, files *modes.FileStatusRegistry) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.Logger.Debug("/api/files/status")
+
+		if !checkUiPassword(uiPass, w, r) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": files.Snapshot(),
+		})
+	}
+}
+
 func handleClientSettingsSave() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type Req struct {
@@ -117,7 +117,7 @@ func TestClientBulkWindow(t *testing.T) {
 	messages := <-client1.ch
 
 	assert.Equal(t, 3, len(messages))
-	assert.GreaterOrEqual(t, int64(time.Since(ts).Milliseconds()), BULK_WINDOW_MS)
+	assert.GreaterOrEqual(t, int64(time.Since(ts).Milliseconds()), DEFAULT_BULK_WINDOW_MS)
 	assert.Equal(t, "foo1", messages[0].Content)
 	assert.Equal(t, "foo2", messages[1].Content)
 	assert.Equal(t, "foo3", messages[2].Content)
@@ -141,7 +141,7 @@ func TestClientCloseError(t *testing.T) {
 
 func TestClientStopFollowAndResume(t *testing.T) {
 	ch := make(chan Message)
-	c := NewClients(ch, 1000)
+	c := NewClientsWithBulkWindow(ch, 1000, 1)
 	client := c.Join(0, true)
 	closed := false
 
@@ -161,7 +161,6 @@ func TestClientStopFollowAndResume(t *testing.T) {
 	delivered := 0
 
 	lastMsgContent := ""
-	BULK_WINDOW_MS = 1
 
 L:
 	for {
@@ -199,8 +198,6 @@ L:
 
 	assert.Equal(t, i1+1, i2)
 
-	BULK_WINDOW_MS = 100
-
 	closed = true
 	close(ch)
 }
@@ -230,14 +227,9 @@ func TestClientsStats(t *testing.T) {
 
 func TestClientStats(t *testing.T) {
 	ch := make(chan Message)
-	c := NewClients(ch, 1000)
+	c := NewClientsWithBulkWindow(ch, 1000, 1)
 	client := c.Join(0, true)
 
-	BULK_WINDOW_MS = 1
-	defer func() {
-		BULK_WINDOW_MS = 100
-	}()
-
 	i := 0
 	for {
 		if i >= 100 {
@@ -276,14 +268,9 @@ func TestClientStats(t *testing.T) {
 
 func TestClientStatsWithLoading(t *testing.T) {
 	ch := make(chan Message)
-	c := NewClients(ch, 1000)
+	c := NewClientsWithBulkWindow(ch, 1000, 1)
 	client := c.Join(0, false)
 
-	BULK_WINDOW_MS = 1
-	defer func() {
-		BULK_WINDOW_MS = 100
-	}()
-
 	i := 0
 	for {
 		if i >= 100 {
@@ -327,7 +314,7 @@ func TestClientPeekLog(t *testing.T) {
 
 func TestClientLoad(t *testing.T) {
 	ch := make(chan Message)
-	c := NewClients(ch, 1000)
+	c := NewClientsWithBulkWindow(ch, 1000, 1)
 	client := c.Join(0, true)
 	closed := false
 
@@ -344,9 +331,7 @@ func TestClientLoad(t *testing.T) {
 	}()
 	time.Sleep(10 * time.Millisecond)
 
-	BULK_WINDOW_MS = 1
 	defer func() {
-		BULK_WINDOW_MS = 100
 		closed = true
 	}()
 
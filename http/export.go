@@ -0,0 +1,230 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fastjson"
+
+	. "github.com/logdyhq/logdy-core/models"
+)
+
+const ExportFormatJsonl = "jsonl"
+const ExportFormatCsv = "csv"
+
+// special columns of an export: a content of a message, its time, id and origin file
+const ExportColumnLine = "@line"
+const ExportColumnTime = "@time"
+const ExportColumnId = "@id"
+const ExportColumnFile = "@file"
+
+type exportRequest struct {
+	format   string
+	columns  []string
+	from     time.Time
+	to       time.Time
+	query    *utils.Query
+	limit    int
+	compress bool
+}
+
+func parseExportRequest(r *http.Request, now time.Time) (exportRequest, error) {
+	q := r.URL.Query()
+	req := exportRequest{format: ExportFormatJsonl}
+
+	if f := q.Get("format"); f != "" {
+		if f != ExportFormatJsonl && f != ExportFormatCsv {
+			return req, fmt.Errorf("unknown format: %s", f)
+		}
+		req.format = f
+	}
+
+	if c := q.Get("columns"); c != "" {
+		req.columns = strings.Split(c, ",")
+	}
+	if req.format == ExportFormatCsv && len(req.columns) == 0 {
+		req.columns = []string{ExportColumnTime, ExportColumnLine}
+	}
+
+	var err error
+	if f := q.Get("from"); f != "" {
+		if req.from, err = utils.ParseTimeExpression(f, now); err != nil {
+			return req, err
+		}
+	}
+	if t := q.Get("to"); t != "" {
+		if req.to, err = utils.ParseTimeExpression(t, now); err != nil {
+			return req, err
+		}
+	}
+
+	if query := q.Get("query"); query != "" {
+		if req.query, err = utils.ParseQuery(query, now); err != nil {
+			return req, err
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if req.limit, err = strconv.Atoi(l); err != nil || req.limit < 0 {
+			return req, fmt.Errorf("invalid limit: %s", l)
+		}
+	}
+
+	switch q.Get("compress") {
+	case "":
+	case "gzip":
+		req.compress = true
+	default:
+		return req, fmt.Errorf("unknown compression: %s", q.Get("compress"))
+	}
+
+	return req, nil
+}
+
+// queryOptions selects messages within the time range matching the query,
+// with a limit only the most recent messages are returned
+func (req exportRequest) queryOptions() QueryOptions {
+	opts := QueryOptions{From: req.from, To: req.to, Limit: req.limit}
+	if req.query != nil {
+		opts.Filter = func(msg Message) bool {
+			return req.query.Match([]byte(msg.Content))
+		}
+	}
+
+	return opts
+}
+
+func exportColumn(msg Message, content *fastjson.Value, column string) *fastjson.Value {
+	a := fastjson.Arena{}
+	switch column {
+	case ExportColumnLine:
+		return a.NewString(msg.Content)
+	case ExportColumnTime:
+		return a.NewString(time.UnixMilli(msg.Ts).Format(time.RFC3339Nano))
+	case ExportColumnId:
+		return a.NewString(msg.Id)
+	case ExportColumnFile:
+		if msg.Origin == nil || msg.Origin.File == "" {
+			return a.NewNull()
+		}
+		return a.NewString(msg.Origin.File)
+	}
+
+	if content != nil {
+		if v := content.Get(strings.Split(column, ".")...); v != nil {
+			return v
+		}
+	}
+	return a.NewNull()
+}
+
+func parseMessageContent(msg Message) *fastjson.Value {
+	if !msg.IsJson {
+		return nil
+	}
+	v, err := fastjson.Parse(msg.Content)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func writeExport(w io.Writer, req exportRequest, msgs []Message) error {
+	if req.format == ExportFormatCsv {
+		cw := csv.NewWriter(w)
+		cw.Write(req.columns)
+		for _, msg := range msgs {
+			content := parseMessageContent(msg)
+			row := make([]string, len(req.columns))
+			for i, column := range req.columns {
+				v := exportColumn(msg, content, column)
+				if v.Type() != fastjson.TypeNull {
+					row[i] = utils.JsonValueString(v)
+				}
+			}
+			cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	for _, msg := range msgs {
+		var bts []byte
+		if len(req.columns) == 0 {
+			// the same format as messages written with `--append-to-file`
+			bts, _ = json.Marshal(msg)
+		} else {
+			content := parseMessageContent(msg)
+			a := fastjson.Arena{}
+			obj := a.NewObject()
+			for _, column := range req.columns {
+				obj.Set(column, exportColumn(msg, content, column))
+			}
+			bts = obj.MarshalTo(nil)
+		}
+
+		if _, err := w.Write(append(bts, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleExport streams messages held in the buffer as JSON lines or CSV, optionally gzip compressed.
+// Query parameters: format (jsonl, csv), columns (JSON fields of a message or @line, @time, @id, @file),
+// from and to (see utils.ParseTimeExpression), query (see utils.Query), limit (the most recent N messages)
+// and compress (gzip).
+func handleExport(uiPass string, clients *ClientsStruct) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.Logger.Debug("/api/export")
+
+		if !checkUiPassword(uiPass, w, r) {
+			return
+		}
+
+		now := time.Now()
+		req, err := parseExportRequest(r, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the buffer is copied so incoming messages don't interfere with a slow download
+		msgs := clients.Query(req.queryOptions())
+
+		filename := "logdy-export-" + now.Format("20060102T150405") + "." + req.format
+		contentType := "application/x-ndjson"
+		if req.format == ExportFormatCsv {
+			contentType = "text/csv"
+		}
+
+		var out io.Writer = w
+		if req.compress {
+			filename += ".gz"
+			contentType = "application/gzip"
+			gw := gzip.NewWriter(w)
+			defer gw.Close()
+			out = gw
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		if err := writeExport(out, req, msgs); err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Exporting messages failed")
+		}
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"slices"
 	"strings"
 
+	"github.com/logdyhq/logdy-core/modes"
 	"github.com/logdyhq/logdy-core/utils"
-
-	"github.com/sirupsen/logrus"
 )
 
 func getClientId(r *http.Request) (string, error) {
@@ -74,61 +74,101 @@ type hand interface {
 	Handle(pattern string, handler http.Handler)
 }
 
-func HandleHttp(config *Config, clients *ClientsStruct, serveMux hand) {
+// Endpoints (paths relative to HttpPathPrefix) which can be disabled with HandlerOptions
+const ENDPOINT_CONFIG_SAVE = "api/config/save"
+const ENDPOINT_LOG = "api/log"
+const ENDPOINT_EXPORT = "api/export"
+const ENDPOINT_FILES_STATUS = "api/files/status"
 
-	assets, _ := Assets()
+type route struct {
+	// a path relative to HttpPathPrefix
+	path    string
+	handler http.Handler
+}
 
-	if config.BulkWindowMs > 0 {
-		BULK_WINDOW_MS = config.BulkWindowMs
-	} else {
-		BULK_WINDOW_MS = 100
-	}
+func (i *Instance) routes() []route {
+	config := i.Config
+	clients := i.Clients
 
-	normalizeHttpPathPrefix(config)
+	assets, _ := Assets()
 
 	// Use the file system to serve static files
 	fs := http.FileServer(http.FS(assets))
 
+	return []route{
+		{"", http.StripPrefix(config.HttpPathPrefix, fs)},
+		{"api/check-pass", http.HandlerFunc(handleCheckPass(config.UiPass))},
+		{"api/status", http.HandlerFunc(handleStatus(config))},
+		{"api/client/set-status", http.HandlerFunc(handleClientStatus(clients))},
+		{"api/client/load", http.HandlerFunc(handleClientLoad(clients))},
+		{"api/client/peek-log", http.HandlerFunc(handleClientPeek(clients))},
+		{ENDPOINT_FILES_STATUS, http.HandlerFunc(handleFilesStatus(config.UiPass, i.FollowedFiles))},
+		{ENDPOINT_EXPORT, http.HandlerFunc(handleExport(config.UiPass, clients))},
+		{ENDPOINT_CONFIG_SAVE, http.HandlerFunc(handleClientSettingsSave())},
+		{"ws", http.HandlerFunc(handleWs(config.UiPass, clients))},
+		{ENDPOINT_LOG, http.HandlerFunc(apiKeyMiddleware(config.ApiKey, handleLog(i.Ch)))},
+	}
+}
+
+// HandleHttp registers the UI and API handlers on the serveMux,
+// or on a mux of the instance served by StartWebserver when it's nil
+func (i *Instance) HandleHttp(serveMux hand) {
+	var mux hand = i.mux
 	v := reflect.ValueOf(serveMux)
 	if serveMux == nil || v.IsNil() {
-		utils.Logger.Debug("Using net/http")
-		http.Handle(config.HttpPathPrefix, http.StripPrefix(config.HttpPathPrefix, fs))
-		http.HandleFunc(config.HttpPathPrefix+"api/check-pass", handleCheckPass(config.UiPass))
-		http.HandleFunc(config.HttpPathPrefix+"api/status", handleStatus(config))
-		http.HandleFunc(config.HttpPathPrefix+"api/client/set-status", handleClientStatus(clients))
-		http.HandleFunc(config.HttpPathPrefix+"api/client/load", handleClientLoad(clients))
-		http.HandleFunc(config.HttpPathPrefix+"api/client/peek-log", handleClientPeek(clients))
-		http.HandleFunc(config.HttpPathPrefix+"api/config/save", handleClientSettingsSave())
-		http.HandleFunc(config.HttpPathPrefix+"ws", handleWs(config.UiPass, clients))
-
-		http.HandleFunc(config.HttpPathPrefix+"api/log", apiKeyMiddleware(config.ApiKey, handleLog(Ch)))
+		utils.Logger.Debug("Using a mux of the instance")
 	} else {
 		utils.Logger.Debug("Using serveMux", serveMux)
-		serveMux.Handle(config.HttpPathPrefix, http.StripPrefix(config.HttpPathPrefix, fs))
-		serveMux.HandleFunc(config.HttpPathPrefix+"api/check-pass", handleCheckPass(config.UiPass))
-		serveMux.HandleFunc(config.HttpPathPrefix+"api/status", handleStatus(config))
-		serveMux.HandleFunc(config.HttpPathPrefix+"api/client/set-status", handleClientStatus(clients))
-		serveMux.HandleFunc(config.HttpPathPrefix+"api/client/load", handleClientLoad(clients))
-		serveMux.HandleFunc(config.HttpPathPrefix+"api/client/peek-log", handleClientPeek(clients))
-		http.HandleFunc(config.HttpPathPrefix+"api/config/save", handleClientSettingsSave())
-		serveMux.HandleFunc(config.HttpPathPrefix+"ws", handleWs(config.UiPass, clients))
-
-		serveMux.HandleFunc(config.HttpPathPrefix+"api/log", apiKeyMiddleware(config.ApiKey, handleLog(Ch)))
+		mux = serveMux
 	}
 
+	for _, rt := range i.routes() {
+		mux.Handle(i.Config.HttpPathPrefix+rt.path, rt.handler)
+	}
+}
+
+// Deprecated: use Instance.HandleHttp, HandleHttp registers handlers serving the clients and messages
+// produced to Ch on the serveMux, or on http.DefaultServeMux served by StartWebserver when it's nil
+func HandleHttp(config *Config, clients *ClientsStruct, serveMux hand) {
+	normalizeHttpPathPrefix(config)
+	InitChannel()
+
+	i := &Instance{
+		Config:        config,
+		Ch:            Ch,
+		Clients:       clients,
+		FollowedFiles: modes.NewFileStatusRegistry(),
+		mux:           http.DefaultServeMux,
+	}
+	i.HandleHttp(serveMux)
 }
 
-func StartWebserver(config *Config) {
-	utils.Logger.Debug("Starting webserver")
-	utils.Logger.WithFields(logrus.Fields{
-		"port": config.ServerPort,
-	}).Info("WebUI started, visit http://" + config.ServerIp + ":" + config.ServerPort + config.HttpPathPrefix)
+type HandlerOptions struct {
+	// Middleware of the application wrapping every route (e.g. authentication),
+	// the first one is the outermost
+	Middleware []func(http.Handler) http.Handler
 
-	err := http.ListenAndServe(config.ServerIp+":"+config.ServerPort, nil)
+	// Endpoints which are not served, e.g. ENDPOINT_CONFIG_SAVE
+	DisabledEndpoints []string
+}
 
-	if err != nil {
-		panic(err)
+// Handler returns a handler serving the UI and API under HttpPathPrefix, independent of any mux,
+// it can be mounted in any router as long as request paths are not stripped of the prefix
+func (i *Instance) Handler(opts HandlerOptions) http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range i.routes() {
+		if slices.Contains(opts.DisabledEndpoints, rt.path) {
+			continue
+		}
+
+		h := rt.handler
+		for j := len(opts.Middleware) - 1; j >= 0; j-- {
+			h = opts.Middleware[j](h)
+		}
+		mux.Handle(i.Config.HttpPathPrefix+rt.path, h)
 	}
+
+	return mux
 }
 
 type Config struct {
@@ -147,6 +187,10 @@ type Config struct {
 	AppendToFileRaw           bool
 	MaxMessageCount           int64
 
+	// Whether produced lines should be written to stdout/stderr as well
+	Fallthrough              bool
+	DisableANSICodeStripping bool
+
 	LogLevel       utils.LOG_LEVEL
 	LogInterceptor utils.LogInterceptor
 }
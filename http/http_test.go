@@ -1,7 +1,18 @@
 package http
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/modes"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNormalizeHttpPrefix(t *testing.T) {
@@ -27,3 +38,75 @@ func TestNormalizeHttpPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleFilesStatus(t *testing.T) {
+	files := modes.NewFileStatusRegistry()
+	err := modes.FollowFilesWithConfig(make(chan models.Message), []string{t.TempDir() + "/missing.log"}, modes.FollowConfig{Status: files})
+	assert.Nil(t, err)
+
+	rr := httptest.NewRecorder()
+	handleFilesStatus("secret", files)(rr, httptest.NewRequest("GET", "/api/files/status", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handleFilesStatus("secret", files)(rr, httptest.NewRequest("GET", "/api/files/status?password=wrong", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handleFilesStatus("secret", files)(rr, httptest.NewRequest("GET", "/api/files/status?password=secret", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	res := struct {
+		Files []models.FileStatus `json:"files"`
+	}{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	assert.Equal(t, 1, len(res.Files))
+	assert.Equal(t, models.FileStateWaiting, res.Files[0].State)
+}
+
+func TestHandleExport(t *testing.T) {
+	ch := make(chan models.Message)
+	c := NewClients(ch, 1000)
+
+	ts := time.Now().Add(-time.Hour).UnixMilli()
+	ch <- models.Message{Id: "1", Content: `{"level":"info","msg":"started"}`, IsJson: true, Ts: ts}
+	ch <- models.Message{Id: "2", Content: `{"level":"error","msg":"failed"}`, IsJson: true, Ts: ts + 1000}
+	ch <- models.Message{Id: "3", Content: `plain, line`, Ts: time.Now().UnixMilli()}
+	time.Sleep(1 * time.Millisecond)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleExport("secret", c)(rr, httptest.NewRequest("GET", "/api/export?password=secret&"+query, nil))
+		return rr
+	}
+
+	rr := export("")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), ".jsonl\"")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	msg := models.Message{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[2]), &msg))
+	assert.Equal(t, "3", msg.Id)
+
+	rr = export("columns=level,msg&query=level:error")
+	assert.Equal(t, `{"level":"error","msg":"failed"}`+"\n", rr.Body.String())
+
+	rr = export("format=csv&columns=@id,msg&from=-30m")
+	assert.Equal(t, "@id,msg\n3,\n", rr.Body.String())
+
+	rr = export("format=csv&columns=@line&limit=1&compress=gzip")
+	assert.Equal(t, "application/gzip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), ".csv.gz\"")
+	gr, err := gzip.NewReader(rr.Body)
+	assert.Nil(t, err)
+	bts, _ := io.ReadAll(gr)
+	assert.Equal(t, "@line\n\"plain, line\"\n", string(bts))
+
+	assert.Equal(t, http.StatusBadRequest, export("format=xml").Code)
+
+	rr = httptest.NewRecorder()
+	handleExport("secret", c)(rr, httptest.NewRequest("GET", "/api/export", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
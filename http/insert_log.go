@@ -1,8 +1,10 @@
 package http
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,6 +17,11 @@ import (
 type LogItemRequest struct {
 	Ts  Timestamp  `json:"ts"`
 	Log LogMessage `json:"log"`
+
+	// Optional, a source of the item overrides a source of the request
+	Source string            `json:"source"`
+	Level  string            `json:"level"`
+	Labels map[string]string `json:"labels"`
 }
 
 type LogRequest struct {
@@ -30,8 +37,19 @@ func handleLog(messageChannel chan models.Message) func(w http.ResponseWriter, r
 			return
 		}
 
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				httpError(err.Error(), w, http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+
 		var p LogRequest
-		err := json.NewDecoder(r.Body).Decode(&p)
+		err := json.NewDecoder(body).Decode(&p)
 
 		if err != nil {
 			httpError(err.Error(), w, http.StatusInternalServerError)
@@ -40,9 +58,16 @@ func handleLog(messageChannel chan models.Message) func(w http.ResponseWriter, r
 
 		utils.Logger.Debugf("Inserting a batch of log messages (%d)", len(p.Logs))
 		for _, el := range p.Logs {
-			modes.ProduceMessageStringTimestamped(messageChannel, el.Log.String, models.MessageTypeStdout, &models.MessageOrigin{
-				ApiSource: p.Source,
-			}, el.Ts.Time)
+			source := el.Source
+			if source == "" {
+				source = p.Source
+			}
+			modes.ProduceMessageWithOptions(messageChannel, el.Log.String, models.LogOptions{
+				Ts:     el.Ts.Time,
+				Source: source,
+				Level:  el.Level,
+				Labels: el.Labels,
+			})
 		}
 
 		w.WriteHeader(http.StatusAccepted)
@@ -54,6 +79,13 @@ type LogMessage struct {
 }
 
 func (t *LogMessage) UnmarshalJSON(data []byte) error {
+	// a JSON string is a line of plain text
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &t.String); err == nil {
+			return nil
+		}
+	}
+
 	t.String = string(data)
 	return nil
 }
@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestUnmarshalJSONTimestamp(t *testing.T) {
@@ -71,6 +73,10 @@ func TestUnmarshalJSONLog(t *testing.T) {
 			input:    `{"asd": "foo"}`,
 			expected: `{"asd": "foo"}`,
 		},
+		{
+			input:    `"plain \"text\""`,
+			expected: `plain "text"`,
+		},
 		{
 			input:    ``,
 			expected: ``,
@@ -221,3 +227,40 @@ func TestHandleLog(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleLogGzip(t *testing.T) {
+	body := &bytes.Buffer{}
+	gz := gzip.NewWriter(body)
+	gz.Write([]byte(`{"source":"api","logs":[
+		{"ts":"2023-07-08T14:00:00.123Z","log":{"foo":"bar"}},
+		{"log":"plain text","source":"billing-job","level":"error","labels":{"tenant":"acme"}}
+	]}`))
+	gz.Close()
+
+	msgChan := make(chan models.Message, 10)
+	req, _ := http.NewRequest("POST", "/log", body)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handleLog(msgChan)(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, 2, len(msgChan))
+
+	msg := <-msgChan
+	assert.Equal(t, `{"foo":"bar"}`, msg.Content)
+	assert.Equal(t, time.Date(2023, 7, 8, 14, 0, 0, 123_000_000, time.UTC).UnixMilli(), msg.Ts)
+	assert.Equal(t, "api", msg.Origin.ApiSource)
+
+	msg = <-msgChan
+	assert.Equal(t, "plain text", msg.Content)
+	assert.WithinDuration(t, time.Now(), time.UnixMilli(msg.Ts), time.Second)
+	assert.Equal(t, "billing-job", msg.Origin.ApiSource)
+	assert.Equal(t, "error", msg.Level)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, msg.Origin.Labels)
+
+	req, _ = http.NewRequest("POST", "/log", bytes.NewBufferString("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handleLog(msgChan)(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
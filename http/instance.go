@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/modes"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Instance holds the whole state of a single Logdy server, multiple instances
+// with their own config, buffer and followed files can run in one process
+type Instance struct {
+	Config *Config
+
+	// A channel messages are produced to
+	Ch chan models.Message
+
+	// Clients connected to the UI and the buffer of messages
+	Clients *ClientsStruct
+
+	// A state of files followed in `follow` mode
+	FollowedFiles *modes.FileStatusRegistry
+
+	// a mux used when the instance is not bound to an existing one
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	server   *http.Server
+	shutdown bool
+	stop     context.CancelFunc
+}
+
+// NewInstance creates an instance and starts processing messages produced to its channel
+func NewInstance(config Config) *Instance {
+	return newInstance(config, make(chan models.Message, 1000))
+}
+
+func newInstance(config Config, ch chan models.Message) *Instance {
+	normalizeHttpPathPrefix(&config)
+
+	bts := int64(0)
+
+	if config.AppendToFileRotateMaxSize != "" {
+		var err error
+		bts, err = utils.ParseRotateSize(config.AppendToFileRotateMaxSize)
+
+		if err != nil {
+			panic(fmt.Errorf("file rotate size parse error: %w", err))
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	produced := modes.ProcessProducedMessages(ch, modes.ProduceOptions{
+		Fallthrough:              config.Fallthrough,
+		DisableANSICodeStripping: config.DisableANSICodeStripping,
+	}, ctx)
+	mainChan := utils.ProcessIncomingMessagesWithRotation(produced, config.AppendToFile, config.AppendToFileRaw, bts, 1000)
+
+	return &Instance{
+		Config:        &config,
+		Ch:            ch,
+		Clients:       NewClientsWithBulkWindow(mainChan, config.MaxMessageCount, config.BulkWindowMs),
+		FollowedFiles: modes.NewFileStatusRegistry(),
+		mux:           http.NewServeMux(),
+		stop:          stop,
+	}
+}
+
+// Shutdown stops the web server, delivers messages already produced, closes the file messages
+// are appended to and closes connections of clients. Inputs producing messages should be stopped first,
+// messages produced afterwards are not delivered.
+func (i *Instance) Shutdown(ctx context.Context) error {
+	i.mu.Lock()
+	server := i.server
+	i.shutdown = true
+	i.mu.Unlock()
+
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+
+	i.stop()
+
+	select {
+	case <-i.Clients.Stopped():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// connections of clients are hijacked so the server doesn't wait for them
+	return errors.Join(err, i.Clients.Wait(ctx))
+}
+
+// StartWebserver serves handlers registered on the mux of the instance until the instance is shut down
+func (i *Instance) StartWebserver() error {
+	config := i.Config
+	utils.Logger.Debug("Starting webserver")
+	utils.Logger.WithFields(logrus.Fields{
+		"port": config.ServerPort,
+	}).Info("WebUI started, visit http://" + config.ServerIp + ":" + config.ServerPort + config.HttpPathPrefix)
+
+	i.mu.Lock()
+	if i.shutdown {
+		i.mu.Unlock()
+		return nil
+	}
+	i.server = &http.Server{
+		Addr:    config.ServerIp + ":" + config.ServerPort,
+		Handler: i.mux,
+	}
+	server := i.server
+	i.mu.Unlock()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Deprecated: use Instance.StartWebserver, StartWebserver serves http.DefaultServeMux
+func StartWebserver(config *Config) {
+	utils.Logger.WithFields(logrus.Fields{
+		"port": config.ServerPort,
+	}).Info("WebUI started, visit http://" + config.ServerIp + ":" + config.ServerPort + config.HttpPathPrefix)
+
+	err := http.ListenAndServe(config.ServerIp+":"+config.ServerPort, nil)
+
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/logdyhq/logdy-core/modes"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/logdyhq/logdy-core/models"
+)
+
+func TestInstancesAreIndependent(t *testing.T) {
+	i1 := NewInstance(Config{HttpPathPrefix: "one", BulkWindowMs: 10})
+	i2 := NewInstance(Config{HttpPathPrefix: "two", DisableANSICodeStripping: true})
+
+	modes.ProduceMessageString(i1.Ch, "\033[31m{\"foo\":\"bar\"}\033[0m", MessageTypeStdout, nil)
+	modes.ProduceMessageString(i2.Ch, "\033[31mred\033[0m", MessageTypeStdout, nil)
+	time.Sleep(10 * time.Millisecond)
+
+	msgs1 := i1.Clients.Query(QueryOptions{})
+	assert.Equal(t, 1, len(msgs1))
+	assert.Equal(t, `{"foo":"bar"}`, msgs1[0].Content)
+	assert.True(t, msgs1[0].IsJson)
+	assert.Equal(t, int64(10), i1.Clients.bulkWindowMs)
+
+	msgs2 := i2.Clients.Query(QueryOptions{})
+	assert.Equal(t, 1, len(msgs2))
+	assert.Equal(t, "\033[31mred\033[0m", msgs2[0].Content)
+	assert.Equal(t, DEFAULT_BULK_WINDOW_MS, i2.Clients.bulkWindowMs)
+
+	mux := http.NewServeMux()
+	i1.HandleHttp(mux)
+	i2.HandleHttp(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/two/api/export?format=csv", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "red")
+	assert.NotContains(t, rr.Body.String(), "foo")
+}
+
+func TestInstanceShutdown(t *testing.T) {
+	file := t.TempDir() + "/messages.log"
+	i := NewInstance(Config{AppendToFile: file, AppendToFileRaw: true, BulkWindowMs: 10})
+
+	mux := http.NewServeMux()
+	i.HandleHttp(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?should_follow=true", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, _, err = conn.ReadMessage() // client joined
+	assert.Nil(t, err)
+
+	for n := 0; n < 3; n++ {
+		modes.ProduceMessageString(i.Ch, "line"+strconv.Itoa(n), MessageTypeStdout, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, i.Shutdown(ctx))
+
+	bts, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "line0\nline1\nline2\n", string(bts))
+
+	delivered := 0
+	for {
+		_, bts, err := conn.ReadMessage()
+		if err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+			break
+		}
+		bulk := MessageBulk{}
+		if json.Unmarshal(bts, &bulk) == nil {
+			delivered += len(bulk.Messages)
+		}
+	}
+	assert.Equal(t, 3, delivered)
+}
+
+func TestInstanceHandler(t *testing.T) {
+	i := NewInstance(Config{HttpPathPrefix: "_logdy-ui"})
+	modes.ProduceMessageString(i.Ch, "foo", MessageTypeStdout, nil)
+	time.Sleep(10 * time.Millisecond)
+
+	wrapped := []string{}
+	h := i.Handler(HandlerOptions{
+		Middleware: []func(http.Handler) http.Handler{
+			func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					wrapped = append(wrapped, r.URL.Path)
+					if r.Header.Get("Authorization") == "" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					next.ServeHTTP(w, r)
+				})
+			},
+		},
+		DisabledEndpoints: []string{ENDPOINT_CONFIG_SAVE},
+	})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/_logdy-ui/api/export", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req := httptest.NewRequest("GET", "/_logdy-ui/api/export", nil)
+	req.Header.Set("Authorization", "secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "foo")
+
+	req = httptest.NewRequest("POST", "/_logdy-ui/api/config/save", strings.NewReader(`{"layout":"{}"}`))
+	req.Header.Set("Authorization", "secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.NoFileExists(t, LOGDY_CONFIG_ENV_FILE)
+
+	assert.Equal(t, []string{"/_logdy-ui/api/export", "/_logdy-ui/api/export", "/_logdy-ui/api/config/save"}, wrapped)
+
+	// nothing is registered on the default mux
+	_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest("GET", "/_logdy-ui/api/config/save", nil))
+	assert.Equal(t, "", pattern)
+}
+
+func TestDeprecatedDefaultInstance(t *testing.T) {
+	InitChannel()
+	clients := InitializeClients(Config{HttpPathPrefix: "legacy"})
+	assert.Equal(t, Clients, clients)
+	assert.Equal(t, clients, InitializeClients(Config{}))
+	assert.Equal(t, BULK_WINDOW_MS, clients.bulkWindowMs)
+
+	modes.ProduceMessageString(Ch, "legacy line", MessageTypeStdout, nil)
+	time.Sleep(10 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	config := &Config{HttpPathPrefix: "legacy"}
+	HandleHttp(config, Clients, mux)
+	assert.Equal(t, "/legacy/", config.HttpPathPrefix)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/legacy/api/export?format=csv", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "legacy line")
+}
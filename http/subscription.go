@@ -0,0 +1,139 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	"github.com/logdyhq/logdy-core/utils"
+
+	. "github.com/logdyhq/logdy-core/models"
+)
+
+// a number of messages a subscriber can fall behind, messages are dropped for it afterwards
+const SUBSCRIPTION_BUFFER_SIZE = 1000
+
+// MessageFilter decides whether a message should be delivered, nil matches every message
+type MessageFilter func(msg Message) bool
+
+// QueryFilter creates a filter matching contents of messages against a query (see utils.Query),
+// e.g. `level:error since:-5m`
+func QueryFilter(query string) (MessageFilter, error) {
+	q, err := utils.ParseQuery(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(msg Message) bool {
+		return q.Match([]byte(msg.Content))
+	}, nil
+}
+
+type subscription struct {
+	ch      chan Message
+	filter  MessageFilter
+	once    sync.Once
+	dropped int
+}
+
+func (s *subscription) close() {
+	s.once.Do(func() {
+		close(s.ch)
+	})
+}
+
+// Subscribe returns a channel receiving messages matching the filter as they arrive,
+// the channel is closed when cancel is called or the clients are stopped. A subscriber
+// that doesn't keep up misses messages instead of delaying delivery to other clients.
+func (c *ClientsStruct) Subscribe(filter MessageFilter) (<-chan Message, func()) {
+	sub := &subscription{
+		ch:     make(chan Message, SUBSCRIPTION_BUFFER_SIZE),
+		filter: filter,
+	}
+
+	c.subsMu.Lock()
+	select {
+	case <-c.stopped:
+		sub.close()
+	default:
+		c.subs[sub] = struct{}{}
+	}
+	c.subsMu.Unlock()
+
+	return sub.ch, func() {
+		c.subsMu.Lock()
+		delete(c.subs, sub)
+		c.subsMu.Unlock()
+		sub.close()
+	}
+}
+
+func (c *ClientsStruct) publish(msg Message) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for sub := range c.subs {
+		if sub.filter != nil && !sub.filter(msg) {
+			continue
+		}
+
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.dropped++
+			if sub.dropped%SUBSCRIPTION_BUFFER_SIZE == 1 {
+				utils.Logger.WithField("dropped", sub.dropped).Warn("Subscriber doesn't keep up, dropping messages")
+			}
+		}
+	}
+}
+
+func (c *ClientsStruct) closeSubscriptions() {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for sub := range c.subs {
+		sub.close()
+		delete(c.subs, sub)
+	}
+}
+
+// QueryOptions select messages held in the buffer
+type QueryOptions struct {
+	Filter MessageFilter
+
+	// A range of times of messages, the range is open when a time is zero
+	From time.Time
+	To   time.Time
+
+	// Only the most recent messages are returned when positive
+	Limit int
+}
+
+// Query returns messages held in the buffer matching the options, from the oldest
+func (c *ClientsStruct) Query(opts QueryOptions) []Message {
+	c.ringMu.RLock()
+	defer c.ringMu.RUnlock()
+
+	msgs := []Message{}
+	c.ring.Scan(func(msg Message, _ int) bool {
+		ts := time.UnixMilli(msg.Ts)
+		if !opts.From.IsZero() && ts.Before(opts.From) {
+			return false
+		}
+		if !opts.To.IsZero() && ts.After(opts.To) {
+			return false
+		}
+		if opts.Filter != nil && !opts.Filter(msg) {
+			return false
+		}
+
+		msgs = append(msgs, msg)
+		return false
+	})
+
+	if opts.Limit > 0 && len(msgs) > opts.Limit {
+		msgs = msgs[len(msgs)-opts.Limit:]
+	}
+
+	return msgs
+}
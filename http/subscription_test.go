@@ -0,0 +1,98 @@
+package http
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/logdyhq/logdy-core/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSubscribe(t *testing.T) {
+	ch := make(chan Message)
+	c := NewClients(ch, 1000)
+
+	filter, err := QueryFilter("level:error")
+	assert.Nil(t, err)
+
+	all, cancelAll := c.Subscribe(nil)
+	errs, cancelErrs := c.Subscribe(filter)
+	defer cancelAll()
+
+	ch <- Message{Id: "1", Content: `{"level":"info"}`}
+	ch <- Message{Id: "2", Content: `{"level":"error"}`}
+
+	assert.Equal(t, "1", (<-all).Id)
+	assert.Equal(t, "2", (<-all).Id)
+	assert.Equal(t, "2", (<-errs).Id)
+
+	cancelErrs()
+	cancelErrs()
+	_, ok := <-errs
+	assert.False(t, ok)
+
+	ch <- Message{Id: "3"}
+	assert.Equal(t, "3", (<-all).Id)
+
+	close(ch)
+	_, ok = <-all
+	assert.False(t, ok)
+
+	// subscribing after the clients are stopped returns a closed channel
+	late, _ := c.Subscribe(nil)
+	_, ok = <-late
+	assert.False(t, ok)
+}
+
+func TestClientSubscribeSlowSubscriber(t *testing.T) {
+	ch := make(chan Message)
+	c := NewClients(ch, 100)
+	msgs, cancel := c.Subscribe(nil)
+	defer cancel()
+
+	for i := 0; i < SUBSCRIPTION_BUFFER_SIZE+10; i++ {
+		ch <- Message{Id: strconv.Itoa(i)}
+	}
+
+	assert.Equal(t, SUBSCRIPTION_BUFFER_SIZE, len(msgs))
+	assert.Equal(t, "0", (<-msgs).Id)
+}
+
+func TestClientQuery(t *testing.T) {
+	ch := make(chan Message)
+	c := NewClients(ch, 1000)
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		level := "info"
+		if i%2 == 0 {
+			level = "error"
+		}
+		ch <- Message{
+			Id:      strconv.Itoa(i),
+			Content: `{"level":"` + level + `"}`,
+			Ts:      now.Add(time.Duration(i-10) * time.Minute).UnixMilli(),
+		}
+	}
+	close(ch)
+	<-c.Stopped()
+
+	filter, err := QueryFilter("level:error")
+	assert.Nil(t, err)
+
+	assert.Len(t, c.Query(QueryOptions{}), 10)
+
+	msgs := c.Query(QueryOptions{Filter: filter, Limit: 2})
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "6", msgs[0].Id)
+	assert.Equal(t, "8", msgs[1].Id)
+
+	msgs = c.Query(QueryOptions{Filter: filter, From: now.Add(-5 * time.Minute)})
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "6", msgs[0].Id)
+
+	msgs = c.Query(QueryOptions{To: now.Add(-9 * time.Minute)})
+	assert.Len(t, msgs, 2)
+}
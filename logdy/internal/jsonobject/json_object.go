@@ -0,0 +1,89 @@
+// Package jsonobject builds JSON objects of log messages keeping an order of their keys
+package jsonobject
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Object is a JSON object keeping an order of its keys
+type Object struct {
+	keys   []string
+	values []any
+}
+
+func (o *Object) Set(key string, value any) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+func (o *Object) Child(key string) *Object {
+	c := &Object{}
+	o.Set(key, c)
+	return c
+}
+
+func (o *Object) Merge(other *Object) {
+	o.keys = append(o.keys, other.keys...)
+	o.values = append(o.values, other.values...)
+}
+
+// Sort orders keys alphabetically
+func (o *Object) Sort() {
+	sort.Sort(o)
+}
+
+func (o *Object) Len() int           { return len(o.keys) }
+func (o *Object) Less(i, j int) bool { return o.keys[i] < o.keys[j] }
+func (o *Object) Swap(i, j int) {
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
+	o.values[i], o.values[j] = o.values[j], o.values[i]
+}
+
+func (o *Object) String() string {
+	buf := bytes.Buffer{}
+	o.writeTo(&buf)
+	return buf.String()
+}
+
+func (o *Object) empty() bool {
+	for _, v := range o.values {
+		if c, ok := v.(*Object); !ok || !c.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTo writes the object as JSON, empty groups are omitted
+func (o *Object) writeTo(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	first := true
+	for i, key := range o.keys {
+		c, isObject := o.values[i].(*Object)
+		if isObject && c.empty() {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		if isObject {
+			c.writeTo(buf)
+			continue
+		}
+
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprintf("%+v", o.values[i]))
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
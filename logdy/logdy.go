@@ -1,8 +1,12 @@
 package logdy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	_http "net/http"
+	"os"
+	"sync"
 
 	"github.com/logdyhq/logdy-core/http"
 	"github.com/logdyhq/logdy-core/models"
@@ -43,6 +47,10 @@ type Config struct {
 
 	// Key to be used when communicating with the REST API
 	ApiKey string
+
+	// Whether stdout and stderr of the process should be captured and sent to the UI,
+	// the output is still written to the original stdout and stderr
+	CaptureOutput bool
 }
 
 type LOG_LEVEL = utils.LOG_LEVEL
@@ -53,37 +61,147 @@ const LOG_LEVEL_SILENT LOG_LEVEL = utils.LOG_LEVEL_SILENT
 const LOG_LEVEL_NORMAL LOG_LEVEL = utils.LOG_LEVEL_NORMAL
 const LOG_LEVEL_VERBOSE LOG_LEVEL = utils.LOG_LEVEL_VERBOSE
 
+const MessageTypeStdout = models.MessageTypeStdout
+const MessageTypeStderr = models.MessageTypeStderr
+
+const ENDPOINT_CONFIG_SAVE = http.ENDPOINT_CONFIG_SAVE
+const ENDPOINT_LOG = http.ENDPOINT_LOG
+const ENDPOINT_EXPORT = http.ENDPOINT_EXPORT
+const ENDPOINT_FILES_STATUS = http.ENDPOINT_FILES_STATUS
+
+// Sink receives messages produced by the adapters (slog, logrus, zap, zerolog and the middleware),
+// it's implemented by Logdy and by client.Client sending messages to a remote Logdy
+type Sink interface {
+	LogStringWithOptions(message string, opts LogOptions) error
+}
+
 type Logdy interface {
 	Config() *Config
 	Log(fields Fields) error
 	LogString(message string) error
 }
 
-type Fields map[string]interface{}
+// Extended is implemented by Logdy returned from InitializeLogdy and New (*LogdyInstance),
+// it's kept apart from Logdy so existing implementations of Logdy keep compiling, e.g.
+//
+//	logger.(logdy.Extended).Shutdown(ctx)
+type Extended interface {
+	Logdy
+
+	// LogWithOptions and LogStringWithOptions log a message with a type, time, source,
+	// labels and level given in options
+	LogWithOptions(fields Fields, opts LogOptions) error
+	LogStringWithOptions(message string, opts LogOptions) error
+
+	// Subscribe returns a channel receiving logged messages matching the filter (nil for all),
+	// the channel is closed when cancel is called or Logdy is shut down. Messages are dropped
+	// for a subscriber that falls more than http.SUBSCRIPTION_BUFFER_SIZE messages behind
+	Subscribe(filter MessageFilter) (msgs <-chan Message, cancel func())
+
+	// Query returns messages held in the buffer matching the options, from the oldest
+	Query(opts QueryOptions) []Message
+
+	// Handler returns a handler serving the UI and API under HttpPathPrefix, it can be mounted in any
+	// router (e.g. chi or gorilla/mux) as long as request paths keep the prefix
+	Handler(opts HandlerOptions) _http.Handler
+
+	// Shutdown stops the web server, delivers logged messages to connected clients and closes their
+	// connections, messages logged afterwards are dropped with ErrShutdown
+	Shutdown(ctx context.Context) error
+}
+
+var ErrShutdown = errors.New("logdy has been shut down")
+
+type Fields = models.Fields
+
+type Message = models.Message
+type LogOptions = models.LogOptions
+type HandlerOptions = http.HandlerOptions
+type MessageFilter = http.MessageFilter
+type QueryOptions = http.QueryOptions
+
+// QueryFilter creates a filter matching contents of messages against a query, e.g. `level:error`
+func QueryFilter(query string) (MessageFilter, error) {
+	return http.QueryFilter(query)
+}
+
+var _ Extended = (*LogdyInstance)(nil)
 
 type LogdyInstance struct {
-	config *Config
+	config   *Config
+	instance *http.Instance
+	capture  *modes.OutputCapture
+
+	// held for reading while a message is sent, so none is sent after the instance stops consuming them
+	mu       sync.RWMutex
+	shutdown bool
 }
 
 func (l *LogdyInstance) Log(fields Fields) error {
+	return l.LogWithOptions(fields, LogOptions{})
+}
 
+func (l *LogdyInstance) LogWithOptions(fields Fields, opts LogOptions) error {
 	serialized, err := json.Marshal(fields)
 	if err != nil {
 		return err
 	}
 
-	modes.ProduceMessageString(http.Ch, string(serialized), models.MessageTypeStdout, &models.MessageOrigin{})
-	return nil
+	return l.LogStringWithOptions(string(serialized), opts)
 }
+
 func (l *LogdyInstance) Config() *Config {
 	return l.config
 }
 
 func (l *LogdyInstance) LogString(message string) error {
-	modes.ProduceMessageString(http.Ch, message, models.MessageTypeStdout, &models.MessageOrigin{})
+	return l.LogStringWithOptions(message, LogOptions{})
+}
+
+func (l *LogdyInstance) LogStringWithOptions(message string, opts LogOptions) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.shutdown {
+		return ErrShutdown
+	}
+	modes.ProduceMessageWithOptions(l.instance.Ch, message, opts)
 	return nil
 }
 
+// Handler returns a handler serving the UI and API under HttpPathPrefix, it can be mounted in any
+// router (e.g. chi or gorilla/mux) as long as request paths keep the prefix
+func (l *LogdyInstance) Handler(opts HandlerOptions) _http.Handler {
+	return l.instance.Handler(opts)
+}
+
+func (l *LogdyInstance) Subscribe(filter MessageFilter) (<-chan Message, func()) {
+	return l.instance.Clients.Subscribe(filter)
+}
+
+func (l *LogdyInstance) Query(opts QueryOptions) []Message {
+	return l.instance.Clients.Query(opts)
+}
+
+func (l *LogdyInstance) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	if l.shutdown {
+		l.mu.Unlock()
+		return nil
+	}
+	l.shutdown = true
+	l.mu.Unlock()
+
+	if l.capture != nil {
+		if utils.Logger.Out == l.capture.Stdout {
+			utils.Logger.Out = os.Stdout
+		}
+		l.capture.Stop()
+	}
+
+	return l.instance.Shutdown(ctx)
+}
+
 func translateToConfig(c *Config) http.Config {
 	return http.Config{
 		AnalyticsDisabled: c.AnalyticsEnabled,
@@ -100,7 +218,25 @@ func translateToConfig(c *Config) http.Config {
 	}
 }
 
+// InitializeLogdy creates Logdy and registers its handlers on the serveMux, or on the default mux
+// when it's nil and Logdy doesn't start a server of its own (ServerIp and ServerPort are empty),
+// the returned Logdy implements Extended
 func InitializeLogdy(config Config, serveMux *_http.ServeMux) Logdy {
+	// without a server of its own, Logdy is served by the application with the default mux
+	if serveMux == nil && (config.ServerPort == "" || config.ServerIp == "") {
+		serveMux = _http.DefaultServeMux
+	}
+
+	return initialize(config, serveMux)
+}
+
+// New creates Logdy without registering its handlers on any mux, they are served by a server
+// of its own when ServerIp and ServerPort are set or mounted in the application with Handler
+func New(config Config) *LogdyInstance {
+	return initialize(config, nil)
+}
+
+func initialize(config Config, serveMux *_http.ServeMux) *LogdyInstance {
 	utils.InitLogger()
 
 	switch config.LogLevel {
@@ -120,15 +256,34 @@ func InitializeLogdy(config Config, serveMux *_http.ServeMux) Logdy {
 
 	c := translateToConfig(&config)
 
-	http.InitChannel()
-	http.InitializeClients(c)
-	http.HandleHttp(&c, http.Clients, serveMux)
+	instance := http.NewInstance(c)
+	instance.HandleHttp(serveMux)
 
-	if c.ServerPort != "" && c.ServerIp != "" {
-		go http.StartWebserver(&c)
+	l := &LogdyInstance{
+		config:   &config,
+		instance: instance,
+	}
+
+	if config.CaptureOutput {
+		capture, err := modes.CaptureOutput(instance.Ch)
+		if err != nil {
+			utils.Logger.WithField("error", err.Error()).Error("Capturing stdout/stderr failed")
+		} else {
+			l.capture = capture
+			// internal logs would be captured otherwise
+			if utils.Logger.Out == os.Stdout {
+				utils.Logger.Out = capture.Stdout
+			}
+		}
 	}
 
-	return &LogdyInstance{
-		config: &config,
+	if c.ServerPort != "" && c.ServerIp != "" {
+		go func() {
+			if err := instance.StartWebserver(); err != nil {
+				utils.Logger.WithField("error", err.Error()).Error("Starting webserver failed")
+			}
+		}()
 	}
+
+	return l
 }
@@ -0,0 +1,48 @@
+package logdy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogdyLogDuringShutdown(t *testing.T) {
+	l := New(Config{LogLevel: LOG_LEVEL_SILENT})
+
+	// more messages than the channel holds are logged while the instance shuts down
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if l.LogString("msg") == ErrShutdown {
+					return
+				}
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, l.Shutdown(ctx))
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging hangs after shutdown")
+	}
+
+	for i := 0; i < 2000; i++ {
+		assert.Equal(t, ErrShutdown, l.LogString("msg"))
+	}
+}
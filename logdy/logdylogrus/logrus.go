@@ -0,0 +1,59 @@
+// Package logdylogrus sends entries logged with logrus to Logdy
+package logdylogrus
+
+import (
+	"time"
+
+	"github.com/logdyhq/logdy-core/logdy"
+	"github.com/logdyhq/logdy-core/logdy/internal/jsonobject"
+	"github.com/sirupsen/logrus"
+)
+
+// Hook sends logrus entries to Logdy as JSON messages with `time`, `level`, `msg` and fields of an entry,
+// entries are still written to the output of a logger, e.g. logger.AddHook(logdylogrus.NewHook(l))
+type Hook struct {
+	logdy  logdy.Sink
+	levels []logrus.Level
+}
+
+// NewHook creates a hook firing for given levels, all levels when none are given
+func NewHook(l logdy.Sink, levels ...logrus.Level) *Hook {
+	if len(levels) == 0 {
+		levels = logrus.AllLevels
+	}
+	return &Hook{logdy: l, levels: levels}
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	ts := entry.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	obj := &jsonobject.Object{}
+	obj.Set("time", ts.Format(time.RFC3339Nano))
+	obj.Set("level", entry.Level.String())
+	obj.Set("msg", entry.Message)
+	if entry.HasCaller() {
+		obj.Set("func", entry.Caller.Function)
+		obj.Set("file", entry.Caller.File)
+		obj.Set("line", entry.Caller.Line)
+	}
+
+	fields := &jsonobject.Object{}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields.Set(k, v)
+	}
+	// fields are kept in the same order as logrus text and JSON formatters do
+	fields.Sort()
+	obj.Merge(fields)
+
+	return h.logdy.LogStringWithOptions(obj.String(), logdy.LogOptions{Ts: ts, Level: entry.Level.String()})
+}
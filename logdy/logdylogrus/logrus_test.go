@@ -0,0 +1,41 @@
+package logdylogrus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/logdy"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSink struct {
+	messages []string
+	opts     []logdy.LogOptions
+}
+
+func (s *testSink) LogStringWithOptions(msg string, opts logdy.LogOptions) error {
+	s.messages = append(s.messages, msg)
+	s.opts = append(s.opts, opts)
+	return nil
+}
+
+func TestHook(t *testing.T) {
+	l := &testSink{}
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.AddHook(NewHook(l, logrus.WarnLevel, logrus.ErrorLevel))
+
+	logger.Info("ignored")
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	logger.WithTime(ts).WithFields(logrus.Fields{"user": "john", "attempt": 2, "error": errors.New("boom")}).Warn("failed")
+
+	assert.Equal(t, []string{`{"time":"2024-01-02T03:04:05Z","level":"warning","msg":"failed","attempt":2,"error":"boom","user":"john"}`}, l.messages)
+	assert.Equal(t, ts, l.opts[0].Ts)
+	assert.Equal(t, "warning", l.opts[0].Level)
+	assert.Contains(t, out.String(), "ignored")
+	assert.Contains(t, out.String(), "failed")
+}
@@ -0,0 +1,77 @@
+// Package logdyzap sends entries logged with zap to Logdy
+package logdyzap
+
+import (
+	"strings"
+
+	"github.com/logdyhq/logdy-core/logdy"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type zapCore struct {
+	zapcore.LevelEnabler
+	enc   zapcore.Encoder
+	logdy logdy.Sink
+}
+
+// NewCore creates a core encoding entries as JSON messages with `time`, `level`, `msg`, `logger`,
+// `caller`, `stacktrace` and fields of an entry, a time of an entry becomes a time of a message
+func NewCore(l logdy.Sink, enab zapcore.LevelEnabler) zapcore.Core {
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		FunctionKey:    zapcore.OmitKey,
+		MessageKey:     "msg",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	})
+
+	return &zapCore{LevelEnabler: enab, enc: enc, logdy: l}
+}
+
+// Tee makes a logger send entries to Logdy next to its existing outputs, with the same levels enabled,
+// e.g. logger = logger.WithOptions(logdyzap.Tee(l))
+func Tee(l logdy.Sink) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, NewCore(l, core))
+	})
+}
+
+func (c *zapCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &zapCore{LevelEnabler: c.LevelEnabler, enc: enc, logdy: c.logdy}
+}
+
+func (c *zapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *zapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	return c.logdy.LogStringWithOptions(strings.TrimSuffix(buf.String(), zapcore.DefaultLineEnding), logdy.LogOptions{
+		Ts:    ent.Time,
+		Level: ent.Level.String(),
+	})
+}
+
+func (c *zapCore) Sync() error {
+	return nil
+}
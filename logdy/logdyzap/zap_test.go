@@ -0,0 +1,37 @@
+package logdyzap
+
+import (
+	"testing"
+
+	"github.com/logdyhq/logdy-core/logdy"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testSink struct {
+	messages []string
+	opts     []logdy.LogOptions
+}
+
+func (s *testSink) LogStringWithOptions(msg string, opts logdy.LogOptions) error {
+	s.messages = append(s.messages, msg)
+	s.opts = append(s.opts, opts)
+	return nil
+}
+
+func TestTee(t *testing.T) {
+	l := &testSink{}
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core).WithOptions(Tee(l)).Named("api").With(zap.String("service", "users"))
+
+	logger.Debug("ignored")
+	logger.Error("failed", zap.Int("attempt", 2), zap.Namespace("req"), zap.String("id", "abc"))
+
+	assert.Equal(t, 1, logs.Len())
+	assert.Equal(t, 1, len(l.messages))
+	assert.Regexp(t, `^\{"level":"error","time":"[^"]+","logger":"api","msg":"failed","service":"users","attempt":2,"req":\{"id":"abc"\}\}$`, l.messages[0])
+	assert.Equal(t, logs.All()[0].Time, l.opts[0].Ts)
+	assert.Equal(t, "error", l.opts[0].Level)
+}
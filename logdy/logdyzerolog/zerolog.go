@@ -0,0 +1,52 @@
+// Package logdyzerolog sends events logged with zerolog to Logdy
+package logdyzerolog
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/logdyhq/logdy-core/logdy"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/valyala/fastjson"
+)
+
+// Writer sends events written by zerolog to Logdy as they are, a time of an event
+// (e.g. `time` field in RFC3339 or unix format) becomes a time of a message.
+// Events are also written to the output when it's set, e.g. zerolog.New(logdyzerolog.NewWriter(l, os.Stderr))
+type Writer struct {
+	logdy logdy.Sink
+	out   io.Writer
+}
+
+// NewWriter creates a writer teeing events to the output, which can be nil
+func NewWriter(l logdy.Sink, out io.Writer) *Writer {
+	return &Writer{logdy: l, out: out}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.out != nil {
+		if n, err := w.out.Write(p); err != nil {
+			return n, err
+		}
+	}
+
+	// zerolog writes a single event at a time, though writes of other JSON lines are handled too
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		ts, ok := utils.ParseLineTime(line)
+		if !ok {
+			ts = time.Now()
+		}
+		opts := logdy.LogOptions{Ts: ts, Level: fastjson.GetString(line, "level")}
+		if err := w.logdy.LogStringWithOptions(string(line), opts); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
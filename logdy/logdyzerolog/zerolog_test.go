@@ -0,0 +1,44 @@
+package logdyzerolog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/logdy"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSink struct {
+	messages []string
+	opts     []logdy.LogOptions
+}
+
+func (s *testSink) LogStringWithOptions(msg string, opts logdy.LogOptions) error {
+	s.messages = append(s.messages, msg)
+	s.opts = append(s.opts, opts)
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	l := &testSink{}
+	out := &bytes.Buffer{}
+	w := NewWriter(l, out)
+
+	event := `{"level":"info","user":"john","time":"2024-01-02T03:04:05Z","message":"hello"}` + "\n"
+	n, err := w.Write([]byte(event))
+	assert.Nil(t, err)
+	assert.Equal(t, len(event), n)
+	n, err = w.Write([]byte(`{"level":"warn","time":1704164645,"message":"unix"}` + "\n"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, event+`{"level":"warn","time":1704164645,"message":"unix"}`+"\n", out.String())
+	assert.Equal(t, []string{
+		`{"level":"info","user":"john","time":"2024-01-02T03:04:05Z","message":"hello"}`,
+		`{"level":"warn","time":1704164645,"message":"unix"}`,
+	}, l.messages)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), l.opts[0].Ts.UTC())
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), l.opts[1].Ts.UTC())
+	assert.Equal(t, "info", l.opts[0].Level)
+	assert.Equal(t, "warn", l.opts[1].Level)
+}
@@ -0,0 +1,213 @@
+package logdy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/logdyhq/logdy-core/logdy/internal/jsonobject"
+)
+
+// a default number of bytes of a request and response body kept in a message
+const MIDDLEWARE_DEFAULT_MAX_BODY_SIZE = 4096
+
+type MiddlewareOptions struct {
+	// Whether request and response bodies should be included in messages
+	LogRequestBody  bool
+	LogResponseBody bool
+
+	// Max number of bytes of a body kept in a message, MIDDLEWARE_DEFAULT_MAX_BODY_SIZE when 0
+	MaxBodySize int
+
+	// A header with an id of a request, an id received in the header is used instead
+	// of a generated one and the id is set in the header of a response, `X-Request-Id` when empty
+	RequestIdHeader string
+
+	// A function deciding whether a request should not be logged,
+	// by default requests to the Logdy UI (HttpPathPrefix and paths under it) are skipped
+	Skip func(r *http.Request) bool
+}
+
+type requestIdKey struct{}
+
+// RequestIdFromContext returns an id of a request assigned by the middleware
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// cappedBuffer keeps only the first `max` bytes written to it
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if left := b.max - b.buf.Len(); left < len(p) {
+		b.truncated = true
+		p = p[:max(left, 0)]
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+type recordingBody struct {
+	io.ReadCloser
+	body *cappedBuffer
+}
+
+func (r *recordingBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.body.Write(p[:n])
+	return n, err
+}
+
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	body   *cappedBuffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	if w.body != nil {
+		w.body.Write(p[:n])
+	}
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the original writer (e.g. to flush)
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recordingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection (e.g. to upgrade it to a websocket)
+func (w *recordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Middleware logs each handled request as a message with `time`, `level` (based on a status),
+// `request_id`, `method`, `path`, `query`, `status`, `latency_ms`, `bytes`, `remote_addr`, `ua`
+// and optionally bodies of the request and response. The request id is available to handlers
+// through RequestIdFromContext, e.g. http.ListenAndServe(":8080", logdy.Middleware(l, logdy.MiddlewareOptions{})(mux))
+func Middleware(l Sink, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = MIDDLEWARE_DEFAULT_MAX_BODY_SIZE
+	}
+	if opts.RequestIdHeader == "" {
+		opts.RequestIdHeader = "X-Request-Id"
+	}
+	if opts.Skip == nil {
+		opts.Skip = func(r *http.Request) bool {
+			// requests of the UI are skipped when Logdy is served by the application
+			lc, ok := l.(interface{ Config() *Config })
+			if !ok {
+				return false
+			}
+			prefix := "/" + strings.Trim(lc.Config().HttpPathPrefix, "/")
+			return prefix != "/" && (r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/"))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			id := r.Header.Get(opts.RequestIdHeader)
+			if id == "" {
+				id = newRequestId()
+			}
+			w.Header().Set(opts.RequestIdHeader, id)
+			r = r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id))
+
+			var reqBody *cappedBuffer
+			if opts.LogRequestBody && r.Body != nil && r.Body != http.NoBody {
+				reqBody = &cappedBuffer{max: opts.MaxBodySize}
+				r.Body = &recordingBody{ReadCloser: r.Body, body: reqBody}
+			}
+
+			rw := &recordingResponseWriter{ResponseWriter: w}
+			if opts.LogResponseBody {
+				rw.body = &cappedBuffer{max: opts.MaxBodySize}
+			}
+
+			next.ServeHTTP(rw, r)
+
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+			level := "info"
+			if rw.status >= 500 {
+				level = "error"
+			} else if rw.status >= 400 {
+				level = "warn"
+			}
+
+			obj := &jsonobject.Object{}
+			obj.Set("time", start.Format(time.RFC3339Nano))
+			obj.Set("level", level)
+			obj.Set("request_id", id)
+			obj.Set("method", r.Method)
+			obj.Set("path", r.URL.Path)
+			obj.Set("query", r.URL.RawQuery)
+			obj.Set("status", rw.status)
+			obj.Set("latency_ms", float64(time.Since(start).Microseconds())/1000)
+			obj.Set("bytes", rw.bytes)
+			obj.Set("remote_addr", r.RemoteAddr)
+			obj.Set("ua", r.UserAgent())
+			if reqBody != nil {
+				obj.Set("request_body", reqBody.buf.String())
+				obj.Set("request_body_truncated", reqBody.truncated)
+			}
+			if rw.body != nil {
+				obj.Set("response_body", rw.body.buf.String())
+				obj.Set("response_body_truncated", rw.body.truncated)
+			}
+
+			l.LogStringWithOptions(obj.String(), LogOptions{Ts: start, Level: level})
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package logdy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfigLogdy struct {
+	testLogdy
+	config Config
+}
+
+func (l *testConfigLogdy) Config() *Config { return &l.config }
+
+func TestMiddleware(t *testing.T) {
+	l := &testConfigLogdy{config: Config{HttpPathPrefix: "_logdy-ui"}}
+	var handlerId string
+	h := Middleware(l, MiddlewareOptions{LogRequestBody: true, LogResponseBody: true, MaxBodySize: 5})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerId = RequestIdFromContext(r.Context())
+		io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/users?page=2", strings.NewReader("abc")))
+
+	assert.Equal(t, 1, len(l.messages))
+	assert.NotEqual(t, "", handlerId)
+	assert.Equal(t, handlerId, rr.Header().Get("X-Request-Id"))
+
+	msg := map[string]any{}
+	assert.Nil(t, json.Unmarshal([]byte(l.messages[0]), &msg))
+	assert.Equal(t, handlerId, msg["request_id"])
+	assert.Equal(t, "warn", msg["level"])
+	assert.Equal(t, "warn", l.opts[0].Level)
+	assert.Equal(t, "POST", msg["method"])
+	assert.Equal(t, "/users", msg["path"])
+	assert.Equal(t, "page=2", msg["query"])
+	assert.Equal(t, float64(404), msg["status"])
+	assert.Equal(t, float64(9), msg["bytes"])
+	assert.Equal(t, "abc", msg["request_body"])
+	assert.Equal(t, false, msg["request_body_truncated"])
+	assert.Equal(t, "not f", msg["response_body"])
+	assert.Equal(t, true, msg["response_body_truncated"])
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Request-Id", "given")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "given", handlerId)
+	assert.NotContains(t, l.messages[1], "request_body")
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_logdy-ui/api/status", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_logdy-ui", nil))
+	assert.Equal(t, 2, len(l.messages))
+
+	// only paths under the prefix are skipped
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_logdy-uix", nil))
+	assert.Equal(t, 3, len(l.messages))
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	l := &testLogdy{}
+	logged := make(chan struct{})
+	h := Middleware(l, MiddlewareOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		close(logged)
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/ws")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "hijacked", string(body))
+
+	<-logged
+	assert.Equal(t, 1, len(l.messages))
+	assert.Contains(t, l.messages[0], `"status":101`)
+}
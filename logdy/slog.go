@@ -0,0 +1,149 @@
+package logdy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/logdyhq/logdy-core/logdy/internal/jsonobject"
+)
+
+// SlogHandler is a slog.Handler producing each record as a JSON message with `time`, `level`,
+// `msg`, `source` (when enabled) and attributes nested in objects named after their groups.
+// A time of a record becomes a time of a message.
+type SlogHandler struct {
+	logdy Sink
+	opts  slog.HandlerOptions
+	goas  []slogGroupOrAttrs
+}
+
+// slogGroupOrAttrs holds either a group opened with WithGroup or attributes added with WithAttrs
+type slogGroupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+// NewSlogHandler creates a handler sending records to Logdy, e.g. slog.SetDefault(slog.New(logdy.NewSlogHandler(l, nil))),
+// opts can be nil in which case records with the info level and above are handled
+func NewSlogHandler(l Sink, opts *slog.HandlerOptions) *SlogHandler {
+	h := &SlogHandler{logdy: l}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := slog.LevelInfo
+	if h.opts.Level != nil {
+		min = h.opts.Level.Level()
+	}
+	return level >= min
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(slogGroupOrAttrs{attrs: attrs})
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(slogGroupOrAttrs{group: name})
+}
+
+func (h *SlogHandler) with(goa slogGroupOrAttrs) *SlogHandler {
+	h2 := *h
+	h2.goas = append(slices.Clip(h.goas), goa)
+	return &h2
+}
+
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	ts := r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	root := &jsonobject.Object{}
+	h.addAttr(root, nil, slog.Time(slog.TimeKey, ts))
+	h.addAttr(root, nil, slog.Any(slog.LevelKey, r.Level))
+	if h.opts.AddSource && r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		f, _ := frames.Next()
+		h.addAttr(root, nil, slog.Any(slog.SourceKey, &slog.Source{Function: f.Function, File: f.File, Line: f.Line}))
+	}
+	h.addAttr(root, nil, slog.String(slog.MessageKey, r.Message))
+
+	obj := root
+	groups := []string{}
+	for _, goa := range h.goas {
+		if goa.group != "" {
+			obj = obj.Child(goa.group)
+			groups = append(groups, goa.group)
+			continue
+		}
+		for _, a := range goa.attrs {
+			h.addAttr(obj, groups, a)
+		}
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.addAttr(obj, groups, a)
+		return true
+	})
+
+	return h.logdy.LogStringWithOptions(root.String(), LogOptions{Ts: ts, Level: strings.ToLower(r.Level.String())})
+}
+
+func (h *SlogHandler) addAttr(obj *jsonobject.Object, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		// attributes of a group without a key are inlined
+		child := obj
+		if a.Key != "" {
+			child = obj.Child(a.Key)
+			groups = append(slices.Clip(groups), a.Key)
+		}
+		for _, ga := range attrs {
+			h.addAttr(child, groups, ga)
+		}
+	case slog.KindTime:
+		obj.Set(a.Key, a.Value.Time().Format(time.RFC3339Nano))
+	case slog.KindDuration:
+		obj.Set(a.Key, a.Value.Duration().Nanoseconds())
+	case slog.KindAny:
+		v := a.Value.Any()
+		switch tv := v.(type) {
+		case error:
+			v = tv.Error()
+		case slog.Level:
+			v = tv.String()
+		case json.Marshaler:
+		case fmt.Stringer:
+			v = tv.String()
+		}
+		obj.Set(a.Key, v)
+	default:
+		obj.Set(a.Key, a.Value.Any())
+	}
+}
@@ -0,0 +1,78 @@
+package logdy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogdy struct {
+	messages []string
+	opts     []LogOptions
+}
+
+func (l *testLogdy) Config() *Config                    { return &Config{} }
+func (l *testLogdy) Log(fields Fields) error            { return nil }
+func (l *testLogdy) LogString(msg string) error         { return l.LogStringWithOptions(msg, LogOptions{}) }
+func (l *testLogdy) Shutdown(ctx context.Context) error { return nil }
+func (l *testLogdy) Query(opts QueryOptions) []Message  { return nil }
+func (l *testLogdy) Handler(opts HandlerOptions) http.Handler {
+	return http.NotFoundHandler()
+}
+func (l *testLogdy) Subscribe(filter MessageFilter) (<-chan Message, func()) {
+	return nil, func() {}
+}
+func (l *testLogdy) LogWithOptions(fields Fields, opts LogOptions) error { return nil }
+func (l *testLogdy) LogStringWithOptions(msg string, opts LogOptions) error {
+	l.messages = append(l.messages, msg)
+	l.opts = append(l.opts, opts)
+	return nil
+}
+
+func TestSlogHandler(t *testing.T) {
+	l := &testLogdy{}
+	logger := slog.New(NewSlogHandler(l, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	logger.Debug("started", "port", 8080, "took", time.Millisecond)
+	logger.With("service", "api").WithGroup("req").With("id", "abc").Error("failed", "err", errors.New("boom"), slog.Group("user", "name", "john"))
+	logger.WithGroup("empty").Info("no attrs")
+
+	assert.Equal(t, 3, len(l.messages))
+	assert.Regexp(t, `^\{"time":"[^"]+","level":"DEBUG","msg":"started","port":8080,"took":1000000\}$`, l.messages[0])
+	assert.Regexp(t, `^\{"time":"[^"]+","level":"ERROR","msg":"failed","service":"api","req":\{"id":"abc","err":"boom","user":\{"name":"john"\}\}\}$`, l.messages[1])
+	assert.Regexp(t, `^\{"time":"[^"]+","level":"INFO","msg":"no attrs"\}$`, l.messages[2])
+	assert.WithinDuration(t, time.Now(), l.opts[0].Ts, time.Second)
+	assert.Equal(t, "debug", l.opts[0].Level)
+	assert.Equal(t, "error", l.opts[1].Level)
+}
+
+func TestSlogHandlerOptions(t *testing.T) {
+	l := &testLogdy{}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := NewSlogHandler(l, &slog.HandlerOptions{
+		AddSource: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "secret" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	assert.False(t, h.Enabled(context.Background(), slog.LevelDebug))
+
+	r := slog.NewRecord(ts, slog.LevelWarn, "hello", 0)
+	r.AddAttrs(slog.String("secret", "x"), slog.Bool("ok", true))
+	assert.Nil(t, h.Handle(context.Background(), r))
+
+	assert.Equal(t, `{"time":"2024-01-02T03:04:05Z","level":"WARN","msg":"hello","ok":true}`, l.messages[0])
+	assert.Equal(t, ts, l.opts[0].Ts)
+
+	slog.New(h).Info("with source")
+	assert.Contains(t, l.messages[1], `"source":{"function":"github.com/logdyhq/logdy-core/logdy.TestSlogHandlerOptions"`)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/logdyhq/logdy-core/utils"
 
@@ -20,6 +23,31 @@ var Version = "0.0.0"
 
 var config *http.Config
 
+var instance *http.Instance
+
+var signalCtx context.Context
+
+// a time given to the instance to deliver messages and close connections on exit
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// logdyInstance returns the instance serving the Web UI, it's created when used for the first time
+// so the utility commands don't start processing messages
+func logdyInstance() *http.Instance {
+	if instance == nil {
+		instance = http.NewInstance(*config)
+	}
+	return instance
+}
+
+// signalContext returns a context done on SIGINT or SIGTERM, the signals are handled only
+// by commands serving the Web UI so that inputs are stopped and the instance is shut down gracefully
+func signalContext() context.Context {
+	if signalCtx == nil {
+		signalCtx, _ = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	}
+	return signalCtx
+}
+
 var rootCmd = &cobra.Command{
 	Use:     "logdy [command]",
 	Short:   "Logdy",
@@ -33,7 +61,7 @@ where you can filter and browse well formatted application output.
 		// by default, `stdin` mode will run if [command] is not provided
 		if len(args) == 0 {
 			utils.Logger.Info("Listen to stdin (from pipe)")
-			go modes.ConsumeStdin(http.Ch)
+			go modes.ConsumeStdin(logdyInstance().Ch)
 			startWebServer(cmd)
 		}
 	},
@@ -52,13 +80,13 @@ var listenStdCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			utils.Logger.Info("Listen to stdin (from pipe)")
-			go modes.ConsumeStdin(http.Ch)
+			go modes.ConsumeStdin(logdyInstance().Ch)
 		} else {
 			utils.Logger.WithFields(logrus.Fields{
 				"cmd": args[0],
 			}).Info("Listen to command stdout")
 			arg := strings.Split(args[0], " ")
-			modes.StartCmd(http.Ch, arg[0], arg[1:])
+			modes.StartCmd(logdyInstance().Ch, arg[0], arg[1:])
 		}
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
@@ -67,19 +95,30 @@ var listenStdCmd = &cobra.Command{
 }
 
 var followCmd = &cobra.Command{
-	Use:   "follow <file1> [<file2> ... <fileN>]",
-	Short: "Follows lines added to files. Example `logdy follow foo.log /var/log/bar.log`",
+	Use:   "follow <file|glob|dir> [<file2> ... <fileN>]",
+	Short: "Follows lines added to files, accepts globs and directories. Example `logdy follow foo.log '/var/log/app/*.log'`",
 	Long:  ``,
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		http.InitializeClients(*config)
 		fullRead, _ := cmd.Flags().GetBool("full-read")
-
-		if fullRead {
-			modes.ReadFiles(http.Ch, args)
+		checkpoint, _ := cmd.Flags().GetString("checkpoint")
+		lines, _ := cmd.Flags().GetInt("lines")
+		since, _ := cmd.Flags().GetDuration("since")
+
+		err := modes.FollowFilesWithConfig(logdyInstance().Ch, args, modes.FollowConfig{
+			FullRead:       fullRead,
+			Status:         logdyInstance().FollowedFiles,
+			Context:        signalContext(),
+			CheckpointFile: checkpoint,
+			Lines:          lines,
+			Since:          since,
+		})
+		if err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Following files failed")
+			os.Exit(1)
 		}
-
-		modes.FollowFiles(http.Ch, args)
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		startWebServer(cmd)
@@ -100,18 +139,34 @@ var forwardCmd = &cobra.Command{
 
 var UtilsCmd = &cobra.Command{
 	Use:   "utils",
-	Short: "A set of utility commands that help working with large files",
+	Short: "A set of utility commands that help working with large files (plain or compressed with gzip, zstd and bzip2)",
 }
 
 var utilsCutByStringCmd = &cobra.Command{
 	Use:   "cut-by-string <file> <start> <end> {case-insensitive = true} {out-file = ''}",
-	Short: "A utility that cuts a file by a start and end string into a new file or standard output.",
+	Short: "A utility that cuts a file by a start and end string into a new file or standard output. Example `logdy utils cut-by-string app.log 'BEGIN req' 'END req' --all --separator=--`",
 	Long:  ``,
 	Args:  cobra.MinimumNArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
 		utils.SetLoggerDiscard(true)
-		modes.UtilsCutByString(utils.AString(args, 0, ""), utils.AString(args, 1, ""), utils.AString(args, 2, ""),
-			utils.ABool(args, 3, true), utils.AString(args, 4, ""), "", 0)
+
+		regex, _ := cmd.Flags().GetBool("regex")
+		all, _ := cmd.Flags().GetBool("all")
+		excludeStart, _ := cmd.Flags().GetBool("exclude-start")
+		excludeEnd, _ := cmd.Flags().GetBool("exclude-end")
+		contextLines, _ := cmd.Flags().GetInt("context")
+		separator, _ := cmd.Flags().GetString("separator")
+
+		modes.UtilsCutByStringWithOptions(utils.AString(args, 0, ""), utils.AString(args, 1, ""), utils.AString(args, 2, ""),
+			utils.AString(args, 4, ""), modes.CutByStringOptions{
+				CaseInsensitive: utils.ABool(args, 3, true),
+				Regex:           regex,
+				All:             all,
+				ExcludeStart:    excludeStart,
+				ExcludeEnd:      excludeEnd,
+				Context:         contextLines,
+				Separator:       separator,
+			})
 	},
 }
 var utilsCutByLineNumberCmd = &cobra.Command{
@@ -127,15 +182,154 @@ var utilsCutByLineNumberCmd = &cobra.Command{
 }
 
 var utilsCutByDateCmd = &cobra.Command{
-	Use:   "cut-by-date <file> <start> <end> <date-format> <search-offset> {out-file = ''}",
-	Short: "A utility that cuts a file by a start and end date into a new file or standard output.",
+	Use: "cut-by-date <file> <start> <end> {out-file = ''}",
+	Short: "A utility that cuts a file by a start and end date into a new file or standard output. " +
+		"The timestamp is detected automatically, start and end can be given in any common format or as relative expressions, e.g. `-2h` or `now`. " +
+		"The legacy form `cut-by-date <file> <start> <end> <date-format> <search-offset> {out-file = ''}` is still supported.",
+	Long: ``,
+	Args: cobra.MinimumNArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetLoggerDiscard(true)
+
+		if len(args) >= 5 {
+			modes.UtilsCutByDate(utils.AString(args, 0, ""), utils.AString(args, 1, ""), utils.AString(args, 2, ""),
+				utils.AString(args, 3, ""), utils.AInt(args, 4, 0), utils.AString(args, 5, ""))
+			return
+		}
+
+		timeField, _ := cmd.Flags().GetString("time-field")
+		modes.UtilsCutByDateAuto(utils.AString(args, 0, ""), utils.AString(args, 1, ""), utils.AString(args, 2, ""),
+			timeField, utils.AString(args, 3, ""))
+	},
+}
+
+var utilsFilterCmd = &cobra.Command{
+	Use: "filter <file> [<file2> ... <fileN>] <query>",
+	Short: "A utility that writes lines of the file(s) matching a query into a new file or standard output. " +
+		"Query terms (all have to match): `field=value`, `field!=value`, `field>n`, `field<=n`, `field~regex`, `/regex/`, " +
+		"`level:error`, `since:-2h`, `until:2024-05-01`, `word`. Example: `logdy utils filter app.log 'level:error status>=500 since:-1d'`",
+	Long: ``,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetLoggerDiscard(true)
+
+		format, _ := cmd.Flags().GetString("format")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		outFile, _ := cmd.Flags().GetString("out-file")
+
+		modes.UtilsFilter(args[:len(args)-1], args[len(args)-1], format, columns, outFile)
+	},
+}
+
+var utilsStatsCmd = &cobra.Command{
+	Use:   "stats <file>",
+	Short: "A utility that summarizes a file: line count, bytes, JSON vs raw lines, time range, lines per minute, levels and the most frequent JSON keys.",
+	Long:  ``,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetLoggerDiscard(true)
+
+		asJson, _ := cmd.Flags().GetBool("json")
+		modes.UtilsStats(args[0], asJson)
+	},
+}
+
+var utilsMergeCmd = &cobra.Command{
+	Use:   "merge <file1> <file2> [<file3> ... <fileN>]",
+	Short: "A utility that interleaves lines of multiple files by their timestamps into a new file or standard output, each line is tagged with its source file. Use --serve to browse the merged lines in the Web UI.",
+	Long:  ``,
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		serve, _ := cmd.Flags().GetBool("serve")
+		if serve {
+			go modes.UtilsMergeServe(logdyInstance().Ch, args)
+			startWebServer(cmd)
+			return
+		}
+
+		utils.SetLoggerDiscard(true)
+		outFile, _ := cmd.Flags().GetString("out-file")
+		modes.UtilsMerge(args, outFile)
+	},
+}
+
+var utilsSplitCmd = &cobra.Command{
+	Use:   "split <file>",
+	Short: "A utility that splits a file into multiple files every N lines or bytes, per time bucket or per distinct value of a JSON field. Example `logdy utils split app.log --time-bucket=1h`",
 	Long:  ``,
-	Args:  cobra.MinimumNArgs(5),
+	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		utils.SetLoggerDiscard(true)
 
-		modes.UtilsCutByString(utils.AString(args, 0, ""), utils.AString(args, 1, ""), utils.AString(args, 2, ""), false,
-			utils.AString(args, 5, ""), utils.AString(args, 3, ""), utils.AInt(args, 4, 0))
+		lines, _ := cmd.Flags().GetInt("lines")
+		bytesStr, _ := cmd.Flags().GetString("bytes")
+		timeBucket, _ := cmd.Flags().GetDuration("time-bucket")
+		field, _ := cmd.Flags().GetString("field")
+		template, _ := cmd.Flags().GetString("name-template")
+
+		var bytes int64
+		if bytesStr != "" {
+			var err error
+			bytes, err = utils.ParseRotateSize(bytesStr)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		counts, err := modes.UtilsSplit(args[0], modes.SplitConfig{
+			Lines:      lines,
+			Bytes:      bytes,
+			TimeBucket: timeBucket,
+			Field:      field,
+			Template:   template,
+		})
+		if err != nil {
+			panic(err)
+		}
+		modes.WriteSplitSummary(counts)
+	},
+}
+
+var utilsConvertCmd = &cobra.Command{
+	Use:   "convert <file>",
+	Short: "A utility that converts a file between JSON lines, logfmt, CSV, TSV and logdy messages (written with --append-to-file) into a new file or standard output. Example `logdy utils convert app.log --from=logfmt --to=json`",
+	Long:  ``,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetLoggerDiscard(true)
+
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		outFile, _ := cmd.Flags().GetString("out-file")
+		if len(columns) == 0 {
+			columns = nil
+		}
+
+		if err := modes.UtilsConvert(args[0], from, to, columns, outFile); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var utilsIndexCmd = &cobra.Command{
+	Use:   "index <file>",
+	Short: "A utility that builds a sidecar index (<file>" + utils.LINE_INDEX_EXT + ") of line offsets and optionally times, it's used automatically by cut-by-line-number, cut-by-date and follow --since to seek without reading the file from the beginning",
+	Long: `An index is used only when it's not stale (the file hasn't been truncated or replaced since it was built),
+lines appended afterwards are read from the last indexed line. follow --full-read doesn't use the index,
+it reads files entirely from the beginning.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetLoggerDiscard(true)
+
+		interval, _ := cmd.Flags().GetInt("interval")
+		withTimes, _ := cmd.Flags().GetBool("times")
+
+		idx, err := modes.UtilsIndex(args[0], interval, withTimes)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Indexed %d lines of %s into %s\n", idx.Lines, args[0], utils.LineIndexPath(args[0]))
 	},
 }
 
@@ -146,7 +340,7 @@ var listenSocketCmd = &cobra.Command{
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		ip, _ := cmd.Flags().GetString("ip")
-		go modes.StartSocketServers(http.Ch, ip, args)
+		go modes.StartSocketServers(logdyInstance().Ch, ip, args, signalContext())
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		startWebServer(cmd)
@@ -168,7 +362,7 @@ var demoSocketCmd = &cobra.Command{
 			}
 		}
 
-		go modes.GenerateRandomData(produceJson, num, http.Ch, context.Background())
+		go modes.GenerateRandomData(produceJson, num, logdyInstance().Ch, signalContext())
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		startWebServer(cmd)
@@ -187,18 +381,72 @@ func startWebServer(cmd *cobra.Command) {
 		utils.Logger.Warn("No opt-out from analytics, we'll be receiving anonymous usage data, which will be used to improve the product. To opt-out use the flag --no-analytics.")
 	}
 
-	http.HandleHttp(config, http.InitializeClients(*config), nil)
-	http.StartWebserver(config)
+	ctx := signalContext()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		// a next signal terminates the process immediately
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+
+		utils.Logger.Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		if err := logdyInstance().Shutdown(shutdownCtx); err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Shutting down failed")
+		}
+	}()
+
+	logdyInstance().HandleHttp(nil)
+	if err := logdyInstance().StartWebserver(); err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Starting webserver failed")
+		os.Exit(1)
+	}
+	<-done
 }
 
 func init() {
 	utils.InitLogger()
-	http.InitChannel()
 
 	rootCmd.AddCommand(UtilsCmd)
 	UtilsCmd.AddCommand(utilsCutByStringCmd)
 	UtilsCmd.AddCommand(utilsCutByDateCmd)
 	UtilsCmd.AddCommand(utilsCutByLineNumberCmd)
+	UtilsCmd.AddCommand(utilsFilterCmd)
+	UtilsCmd.AddCommand(utilsStatsCmd)
+	UtilsCmd.AddCommand(utilsMergeCmd)
+	UtilsCmd.AddCommand(utilsSplitCmd)
+	UtilsCmd.AddCommand(utilsConvertCmd)
+	UtilsCmd.AddCommand(utilsIndexCmd)
+
+	utilsCutByStringCmd.Flags().BoolP("regex", "", false, "Start and end are regular expressions")
+	utilsCutByStringCmd.Flags().BoolP("all", "", false, "Cut every range instead of only the first one")
+	utilsCutByStringCmd.Flags().BoolP("exclude-start", "", false, "Don't include lines matching start")
+	utilsCutByStringCmd.Flags().BoolP("exclude-end", "", false, "Don't include lines matching end")
+	utilsCutByStringCmd.Flags().IntP("context", "", 0, "Number of lines before the start to include, like grep -B")
+	utilsCutByStringCmd.Flags().StringP("separator", "", "", "A line written between ranges, example: --separator=--")
+	utilsCutByDateCmd.Flags().StringP("time-field", "", "", "A JSON field (nested fields separated with a dot, e.g. meta.ts) holding a timestamp, by default the timestamp is detected automatically")
+	utilsFilterCmd.Flags().StringP("format", "", modes.FilterFormatRaw, "Output format: raw, json or csv")
+	utilsFilterCmd.Flags().StringSliceP("columns", "", []string{}, "Columns included in json and csv output, JSON fields (nested separated with a dot) or @line and @time, example: --columns=@time,level,msg")
+	utilsFilterCmd.Flags().StringP("out-file", "", "", "Path to a file where matching lines will be written, standard output by default")
+	utilsStatsCmd.Flags().BoolP("json", "", false, "Output the summary as JSON")
+	utilsMergeCmd.Flags().StringP("out-file", "", "", "Path to a file where merged lines will be written, standard output by default")
+	utilsMergeCmd.Flags().BoolP("serve", "", false, "Serve merged lines in the Web UI with times taken from the lines")
+	utilsSplitCmd.Flags().IntP("lines", "", 0, "Split every N lines")
+	utilsSplitCmd.Flags().StringP("bytes", "", "", "Split every N bytes (lines are never split), use K/M/G to describe the size, example: 100M")
+	utilsSplitCmd.Flags().DurationP("time-bucket", "", 0, "Split per time bucket (named by its start in UTC), the timestamp is detected automatically, example: 1h")
+	utilsSplitCmd.Flags().StringP("field", "", "", "Split per distinct value of a JSON field (nested fields separated with a dot)")
+	utilsSplitCmd.Flags().StringP("name-template", "", "", "Template of output file names with placeholders: {base}, {ext}, {n}, {bucket}, {value}, by default {base}.{n}{ext}, {base}.{bucket}{ext} or {base}.{value}{ext} depending on the mode")
+	utilsConvertCmd.Flags().StringP("from", "", modes.ConvertFormatJson, "Input format: json, logfmt, csv, tsv or logdy")
+	utilsConvertCmd.Flags().StringP("to", "", modes.ConvertFormatJson, "Output format: json, logfmt, csv, tsv or logdy")
+	utilsConvertCmd.Flags().StringSliceP("columns", "", []string{}, "Columns of csv and tsv output, by default fields of the first line are used")
+	utilsConvertCmd.Flags().StringP("out-file", "", "", "Path to a file where converted lines will be written, standard output by default")
+	utilsIndexCmd.Flags().IntP("interval", "", utils.LINE_INDEX_DEFAULT_INTERVAL, "Offset of every N-th line is indexed")
+	utilsIndexCmd.Flags().BoolP("times", "", false, "Index times of lines as well (in any of the supported formats), used to seek by date when a date is extracted the same way")
 
 	rootCmd.PersistentFlags().StringP("port", "p", "8080", "Port on which the Web UI will be served (env: LOGDY_PORT)")
 	rootCmd.PersistentFlags().StringP("ui-ip", "", "127.0.0.1", "Bind Web UI server to a specific IP address (env: LOGDY_UI_IP)")
@@ -228,6 +476,9 @@ func init() {
 	rootCmd.AddCommand(demoSocketCmd)
 
 	followCmd.Flags().BoolP("full-read", "", false, "Whether the the file(s) should be read entirely")
+	followCmd.Flags().IntP("lines", "", 0, "Number of last lines of the file(s) to be read before following them, like tail -n")
+	followCmd.Flags().DurationP("since", "", 0, "Read the file(s) starting with the first line newer than the duration, example: 30m, the lines should be sorted by time")
+	followCmd.Flags().StringP("checkpoint", "", "", "Path to a file where offsets of followed files are stored, on restart following is resumed from the stored offsets")
 	rootCmd.AddCommand(followCmd)
 
 }
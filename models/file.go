@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type FileState string
+
+const FileStateWaiting FileState = "waiting"
+const FileStateFollowing FileState = "following"
+const FileStateDeleted FileState = "deleted"
+const FileStateError FileState = "error"
+
+type FileEventType string
+
+const FileEventTruncated FileEventType = "file_truncated"
+const FileEventRotated FileEventType = "file_rotated"
+const FileEventDeleted FileEventType = "file_deleted"
+const FileEventRecreated FileEventType = "file_recreated"
+
+// FileEvent is a content of a message produced when a followed file changes in a way
+// other than appending lines
+type FileEvent struct {
+	Event   FileEventType `json:"event"`
+	File    string        `json:"file"`
+	Message string        `json:"message"`
+}
+
+type FileStatus struct {
+	Path  string    `json:"path"`
+	State FileState `json:"state"`
+	Error string    `json:"error,omitempty"`
+
+	// offset after the last line read and the size of the file at the last check
+	Offset    int64 `json:"offset"`
+	Size      int64 `json:"size"`
+	LineCount int   `json:"line_count"`
+
+	LastLineAt  time.Time     `json:"last_line_at"`
+	LastCheckAt time.Time     `json:"last_check_at"`
+	LastEvent   FileEventType `json:"last_event,omitempty"`
+	LastEventAt time.Time     `json:"last_event_at"`
+}
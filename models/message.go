@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"time"
 )
 
 type LogType int
@@ -9,6 +10,9 @@ type LogType int
 const MessageTypeStdout LogType = 1
 const MessageTypeStderr LogType = 2
 
+// Events produced by Logdy itself, e.g. a followed file has been truncated
+const MessageTypeEvent LogType = 3
+
 const MessageTypeInit string = "init"
 const MessageTypeLogBulk string = "log_bulk"
 const MessageTypeLogSingle string = "log_single"
@@ -16,9 +20,10 @@ const MessageTypeClientJoined string = "client_joined"
 const MessageTypeClientMsgStatus string = "client_msg_status"
 
 type MessageOrigin struct {
-	Port      string `json:"port"`
-	File      string `json:"file"`
-	ApiSource string `json:"api_source"`
+	Port      string            `json:"port"`
+	File      string            `json:"file"`
+	ApiSource string            `json:"api_source"`
+	Labels    map[string]string `json:"labels"`
 }
 
 type Message struct {
@@ -30,6 +35,29 @@ type Message struct {
 	IsJson      bool            `json:"is_json"`
 	Ts          int64           `json:"ts"`
 	Origin      *MessageOrigin  `json:"origin"`
+	Level       string          `json:"level"`
+}
+
+// Fields of a structured message serialized to JSON
+type Fields map[string]interface{}
+
+// LogOptions describe a message produced by an application using Logdy as a library
+type LogOptions struct {
+	// MessageTypeStdout (the default) or MessageTypeStderr
+	Type LogType
+
+	// A time of the message, the current time is used when it's zero
+	Ts time.Time
+
+	// A name of a part of the application producing the message (e.g. a background job),
+	// presented the same way as a source of messages sent through the REST API
+	Source string
+
+	// Arbitrary labels describing the origin of the message
+	Labels map[string]string
+
+	// A level of the message, e.g. info or error
+	Level string
 }
 
 type MessageBulk struct {
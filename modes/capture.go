@@ -0,0 +1,135 @@
+package modes
+
+import (
+	"bytes"
+	"os"
+	"runtime/debug"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// OutputCapture redirects stdout and stderr of the process to messages,
+// Stdout and Stderr are the original outputs the captured output is passed through to,
+// they are closed by Stop when they are duplicates of the original descriptors
+type OutputCapture struct {
+	Stdout *os.File
+	Stderr *os.File
+
+	restore []func() error
+	writers []*os.File
+	done    []chan struct{}
+}
+
+// CaptureOutput redirects stdout and stderr of the process (including output of `fmt`, `log`
+// and other packages writing to them) to messages of MessageTypeStdout and MessageTypeStderr,
+// the output is still written to the original outputs. Panics crashing the process
+// are written to the original stderr.
+func CaptureOutput(ch chan models.Message) (*OutputCapture, error) {
+	c := &OutputCapture{}
+
+	var err error
+	c.Stdout, err = c.capture(&os.Stdout, ch, models.MessageTypeStdout)
+	if err != nil {
+		return nil, err
+	}
+	c.Stderr, err = c.capture(&os.Stderr, ch, models.MessageTypeStderr)
+	if err != nil {
+		c.Stop()
+		return nil, err
+	}
+
+	// the output written by the runtime when the process crashes would be lost in the pipe
+	if err := debug.SetCrashOutput(c.Stderr, debug.CrashOptions{}); err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Debug("Setting crash output failed")
+	}
+
+	utils.Logger.Info("Capturing stdout/stderr")
+	return c, nil
+}
+
+func (c *OutputCapture) capture(target **os.File, ch chan models.Message, mt models.LogType) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	orig, restore, err := redirectOutput(target, w)
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go passOutput(r, orig, ch, mt, done)
+
+	c.restore = append(c.restore, restore)
+	c.writers = append(c.writers, w)
+	c.done = append(c.done, done)
+	return orig, nil
+}
+
+// passOutput writes the output to the original file as soon as it's read
+// and produces a message for each complete line
+func passOutput(r *os.File, orig *os.File, ch chan models.Message, mt models.LogType, done chan struct{}) {
+	defer close(done)
+	defer r.Close()
+
+	buf := make([]byte, 32*1024)
+	line := []byte{}
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			orig.Write(buf[:n])
+			line = append(line, buf[:n]...)
+
+			for {
+				i := bytes.IndexByte(line, '\n')
+				if i < 0 {
+					break
+				}
+				ProduceMessageString(ch, string(bytes.TrimSuffix(line[:i], []byte{'\r'})), mt, nil)
+				line = line[i+1:]
+			}
+			line = append([]byte{}, line...)
+		}
+
+		if err != nil {
+			if len(line) > 0 {
+				ProduceMessageString(ch, string(line), mt, nil)
+			}
+			return
+		}
+	}
+}
+
+// Stop restores the original outputs and waits until the captured output is produced
+func (c *OutputCapture) Stop() {
+	for _, restore := range c.restore {
+		if err := restore(); err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Restoring output failed")
+		}
+	}
+	for _, w := range c.writers {
+		w.Close()
+	}
+	for _, done := range c.done {
+		<-done
+	}
+
+	debug.SetCrashOutput(nil, debug.CrashOptions{})
+
+	// duplicates of the original descriptors are not needed once they're restored
+	for _, orig := range []*os.File{c.Stdout, c.Stderr} {
+		if orig != nil && orig != os.Stdout && orig != os.Stderr {
+			orig.Close()
+		}
+	}
+	c.restore, c.writers, c.done = nil, nil, nil
+}
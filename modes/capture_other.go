@@ -0,0 +1,19 @@
+//go:build !unix
+
+package modes
+
+import (
+	"os"
+)
+
+// redirectOutput replaces the target file with the writer, only output written
+// through os.Stdout and os.Stderr variables is redirected
+func redirectOutput(target **os.File, w *os.File) (*os.File, func() error, error) {
+	orig := *target
+	*target = w
+
+	return orig, func() error {
+		*target = orig
+		return nil
+	}, nil
+}
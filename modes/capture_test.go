@@ -0,0 +1,30 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	ch := make(chan models.Message, 10)
+	c, err := CaptureOutput(ch)
+	assert.Nil(t, err)
+
+	fmt.Println("captured line")
+	fmt.Fprint(os.Stderr, "error without newline")
+	c.Stop()
+
+	fmt.Println("not captured")
+	close(ch)
+
+	msgs := map[models.LogType][]string{}
+	for msg := range ch {
+		msgs[msg.Mtype] = append(msgs[msg.Mtype], msg.Content)
+	}
+	assert.Equal(t, []string{"captured line"}, msgs[models.MessageTypeStdout])
+	assert.Equal(t, []string{"error without newline"}, msgs[models.MessageTypeStderr])
+}
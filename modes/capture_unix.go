@@ -0,0 +1,32 @@
+//go:build unix
+
+package modes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectOutput points a file descriptor of the target to the writer so output written
+// directly to the descriptor (e.g. by the runtime or C code) is redirected too,
+// it returns a duplicate of the original descriptor
+func redirectOutput(target **os.File, w *os.File) (*os.File, func() error, error) {
+	fd := int((*target).Fd())
+
+	dup, err := unix.Dup(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	unix.CloseOnExec(dup)
+
+	if err := unix.Dup2(int(w.Fd()), fd); err != nil {
+		unix.Close(dup)
+		return nil, nil, err
+	}
+
+	orig := os.NewFile(uintptr(dup), (*target).Name())
+	return orig, func() error {
+		return unix.Dup2(dup, fd)
+	}, nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package modes
+
+import (
+	"os"
+	"testing"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureOutputClosesDuplicates(t *testing.T) {
+	ch := make(chan models.Message, 10)
+	c, err := CaptureOutput(ch)
+	assert.Nil(t, err)
+	c.Stop()
+
+	assert.ErrorIs(t, c.Stdout.Close(), os.ErrClosed)
+	assert.ErrorIs(t, c.Stderr.Close(), os.ErrClosed)
+	_, err = os.Stdout.Stat()
+	assert.Nil(t, err)
+	_, err = os.Stderr.Stat()
+	assert.Nil(t, err)
+}
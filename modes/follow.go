@@ -1,74 +1,652 @@
 package modes
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/logdyhq/logdy-core/utils"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/nxadm/tail"
 	"github.com/sirupsen/logrus"
 
 	"github.com/logdyhq/logdy-core/models"
 )
 
-func FollowFiles(ch chan models.Message, files []string) {
+type FollowConfig struct {
+	// Whether existing files should be read entirely before following them
+	FullRead bool
+
+	// A path to a file where offsets of followed files are persisted,
+	// following is resumed from these offsets on restart
+	CheckpointFile string
+
+	// Number of last lines of existing files to be read before following them
+	Lines int
+
+	// Existing files are read starting with the first line not older than this duration,
+	// lines are expected to be sorted by time
+	Since time.Duration
+
+	// A registry where a state of followed files is kept, a new one is created when empty
+	Status *FileStatusRegistry
+
+	// How often followed files are checked for truncation, rotation and deletion,
+	// FILE_DEFAULT_CHECK_INTERVAL when 0
+	CheckInterval time.Duration
+
+	// Following stops and the checkpoint is saved when the context is done,
+	// files are followed until the process exits when empty
+	Context context.Context
+}
+
+type fileFollower struct {
+	ctx        context.Context
+	ch         chan models.Message
+	config     FollowConfig
+	checkpoint *checkpointStore
+	status     *FileStatusRegistry
+	mu         sync.Mutex
+	followed   map[string]bool
+	patterns   map[string][]string    // watched directory -> patterns matched against files created in it
+	dirs       map[string][]string    // watched directory -> patterns its new subdirectories can lead to
+	read       map[fileIdentity]int64 // identity of a followed file -> offset read, recognizes renamed files
+	watcher    *fsnotify.Watcher
+}
+
+type fileIdentity struct {
+	dev uint64
+	ino uint64
+}
+
+func newFileFollower(ch chan models.Message, config FollowConfig) *fileFollower {
+	status := config.Status
+	if status == nil {
+		status = NewFileStatusRegistry()
+	}
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = FILE_DEFAULT_CHECK_INTERVAL
+	}
 
-	for _, file := range files {
+	return &fileFollower{
+		ctx:      ctx,
+		ch:       ch,
+		config:   config,
+		status:   status,
+		followed: map[string]bool{},
+		patterns: map[string][]string{},
+		dirs:     map[string][]string{},
+		read:     map[fileIdentity]int64{},
+	}
+}
+
+func isGlobPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// resolvePattern turns a path provided by the user into a glob pattern,
+// a directory is translated into a pattern matching all of the files inside it
+func resolvePattern(path string) string {
+	path = filepath.Clean(path)
+	if isGlobPattern(path) {
+		return path
+	}
+
+	fi, err := os.Stat(path)
+	if err == nil && fi.IsDir() {
+		return filepath.Join(path, "*")
+	}
+
+	return path
+}
 
-		_, err := os.Stat(file)
+// ExpandFilePaths returns a list of files matching provided paths, a path can be a file,
+// a glob pattern or a directory. Directories are skipped, other files (e.g. named pipes) are kept
+func ExpandFilePaths(paths []string) []string {
+	files := []string{}
+	seen := map[string]bool{}
+
+	for _, path := range paths {
+		matches, err := filepath.Glob(resolvePattern(path))
 		if err != nil {
 			utils.Logger.WithFields(logrus.Fields{
-				"path":  file,
+				"path":  path,
 				"error": err.Error(),
-			}).Error("Following file changes failed")
+			}).Error("Invalid file pattern")
 			continue
 		}
+
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil || fi.IsDir() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+
+	return files
+}
+
+// FollowFiles follows lines added to files, a path can be a file, a glob pattern
+// or a directory. Files that do not exist yet or are created later on
+// and match one of the paths are followed as soon as they appear
+func FollowFiles(ch chan models.Message, files []string) {
+	FollowFilesWithConfig(ch, files, FollowConfig{})
+}
+
+// FollowFilesWithConfig follows files the same way FollowFiles does,
+// additionally files can be read entirely first and offsets can be persisted in a checkpoint file
+func FollowFilesWithConfig(ch chan models.Message, files []string, config FollowConfig) error {
+	if config.FullRead && (config.Lines > 0 || config.Since > 0) {
+		return errors.New("full read can't be combined with reading last lines or since a time")
+	}
+	if config.Lines > 0 && config.Since > 0 {
+		return errors.New("reading last lines can't be combined with reading since a time")
+	}
+
+	f := newFileFollower(ch, config)
+
+	if config.CheckpointFile != "" {
+		cp, err := loadCheckpoint(config.CheckpointFile)
+		if err != nil {
+			return err
+		}
+		f.checkpoint = cp
+		go cp.startFlushLoop(f.ctx)
+	}
+
+	f.follow(files)
+	return nil
+}
+
+func (f *fileFollower) follow(paths []string) {
+	for _, path := range paths {
+		pattern := resolvePattern(path)
+
+		matches := ExpandFilePaths([]string{pattern})
+		for _, file := range matches {
+			f.startExisting(file)
+		}
+
+		if len(matches) == 0 && !isGlobPattern(path) {
+			utils.Logger.WithFields(logrus.Fields{
+				"path": path,
+			}).Info("File does not exist yet, waiting for it to appear")
+			f.setWaiting(pattern)
+		}
+
+		f.watch(pattern)
+	}
+}
+
+// watchedDirPatterns returns patterns of directories the pattern can expand into,
+// from the last directory without a glob to the directory part of the pattern,
+// e.g. logs/*/app/*.log gives logs, logs/* and logs/*/app
+func watchedDirPatterns(pattern string) []string {
+	dir := filepath.Dir(pattern)
+	levels := []string{dir}
+	for isGlobPattern(dir) {
+		dir = filepath.Dir(dir)
+		levels = append([]string{dir}, levels...)
+	}
+
+	return levels
+}
+
+// watch observes directories the pattern can expand into for newly created files,
+// subdirectories created later on are observed as soon as they appear
+func (f *fileFollower) watch(pattern string) {
+	levels := watchedDirPatterns(pattern)
+	if dirs, err := filepath.Glob(levels[0]); err != nil || len(dirs) == 0 {
 		utils.Logger.WithFields(logrus.Fields{
-			"path": file,
-		}).Info("Following file changes")
-
-		go func(file string) {
-			t, err := tail.TailFile(
-				file, tail.Config{Follow: true, ReOpen: true, Location: &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}})
-			if err != nil {
-				utils.Logger.WithFields(logrus.Fields{
-					"path":  file,
-					"error": err.Error(),
-				}).Error("Following file changes failed")
+			"path": pattern,
+		}).Error("Directory does not exist, new files will not be followed")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.watcher == nil {
+		var err error
+		f.watcher, err = fsnotify.NewWatcher()
+		if err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Starting file system watcher failed")
+			return
+		}
+		watcher := f.watcher
+		context.AfterFunc(f.ctx, func() {
+			watcher.Close()
+		})
+		go f.watchLoop()
+	}
+
+	for i, level := range levels {
+		dirs, _ := filepath.Glob(level)
+		for _, dir := range dirs {
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				continue
+			}
+			if !f.addWatch(dir) {
+				continue
 			}
+			if i == len(levels)-1 {
+				f.patterns[dir] = appendUnique(f.patterns[dir], pattern)
+			} else {
+				f.dirs[dir] = appendUnique(f.dirs[dir], pattern)
+			}
+		}
+	}
+}
+
+// addWatch adds the directory to the watcher unless it's already watched, f.mu must be held
+func (f *fileFollower) addWatch(dir string) bool {
+	_, hasFiles := f.patterns[dir]
+	_, hasDirs := f.dirs[dir]
+	if hasFiles || hasDirs {
+		return true
+	}
 
-			for line := range t.Lines {
-				ProduceMessageString(ch, line.Text, models.MessageTypeStdout, &models.MessageOrigin{File: file})
+	if err := f.watcher.Add(dir); err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  dir,
+			"error": err.Error(),
+		}).Error("Watching directory failed")
+		return false
+	}
+
+	return true
+}
+
+func appendUnique(patterns []string, pattern string) []string {
+	if slices.Contains(patterns, pattern) {
+		return patterns
+	}
+	return append(patterns, pattern)
+}
+
+// watchNewDir starts watching a directory created after we started when patterns can
+// expand into it, files created in it before it was watched are followed from the beginning
+func (f *fileFollower) watchNewDir(dir string) {
+	f.mu.Lock()
+	patterns := slices.Clone(f.dirs[filepath.Dir(dir)])
+	f.mu.Unlock()
+
+	for _, pattern := range patterns {
+		f.watch(pattern)
+		for _, file := range ExpandFilePaths([]string{pattern}) {
+			f.startTail(file, 0, false)
+		}
+	}
+}
+
+func (f *fileFollower) watchLoop() {
+	for {
+		select {
+		case event, ok := <-f.watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+				if event.Has(fsnotify.Create) {
+					f.watchNewDir(event.Name)
+				}
+				continue
+			}
+			if f.matches(event.Name) {
+				// the file has been created after we started, read it from the beginning
+				// unless it's a followed file renamed by rotation (e.g. app.log -> app.log.1)
+				offset, renamed := f.renamedOffset(event.Name)
+				f.startTail(event.Name, offset, renamed)
 			}
+		case err, ok := <-f.watcher.Errors:
+			if !ok {
+				return
+			}
+			utils.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("File system watcher error")
+		}
+	}
+}
 
-		}(file)
+func (f *fileFollower) matches(file string) bool {
+	f.mu.Lock()
+	patterns := f.patterns[filepath.Dir(file)]
+	f.mu.Unlock()
+
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, file); ok {
+			fi, err := os.Stat(file)
+			return err == nil && !fi.IsDir()
+		}
 	}
 
+	return false
 }
 
-func ReadFiles(ch chan models.Message, files []string) {
-	for _, file := range files {
+// startExisting decides where to start following a file that existed on startup:
+// a checkpoint offset, the beginning (full read), last lines, a time or the end of the file
+func (f *fileFollower) startExisting(file string) {
+	if f.isFollowed(file) {
+		return
+	}
 
-		_, err := os.Stat(file)
+	if offset, ok := f.resumeOffset(file); ok {
+		f.startTail(file, offset, false)
+		return
+	}
+
+	if f.config.FullRead {
+		read := readFile(f.ch, file)
+		f.startTail(file, read, false)
+		return
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  file,
+			"error": err.Error(),
+		}).Error("Following file changes failed")
+		return
+	}
+
+	offset := fi.Size()
+	if (f.config.Lines > 0 || f.config.Since > 0) && !utils.IsCompressedFile(file) {
+		offset, err = f.startOffset(file, fi.Size())
 		if err != nil {
 			utils.Logger.WithFields(logrus.Fields{
 				"path":  file,
 				"error": err.Error(),
-			}).Error("Reading file failed")
-			continue
+			}).Error("Seeking file failed, following from the end")
+			offset = fi.Size()
 		}
+	}
+
+	f.startTail(file, offset, false)
+}
+
+// startOffset finds an offset of the last N lines or the first line since a time
+func (f *fileFollower) startOffset(file string, size int64) (int64, error) {
+	r, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	if f.config.Lines > 0 {
+		return utils.SeekLastLines(r, size, f.config.Lines)
+	}
+
+	since := time.Now().Add(-f.config.Since)
+
+	// with an index, only lines after the closest indexed line are searched
+	extractor := utils.AnyTimeExtractor()
+	if idx, ok := utils.LoadLineIndex(file); ok && idx.TimesExtractedWith(extractor) && idx.SortedByTime() {
+		start := idx.TimeOffset(since)
+		offset, err := utils.SearchFileByTime(io.NewSectionReader(r, start, size-start), size-start, since, extractor.Extract)
+		return start + offset, err
+	}
+
+	return utils.SearchFileByTime(r, size, since, extractor.Extract)
+}
+
+// resumeOffset returns an offset stored in the checkpoint for a file,
+// when the file has been rotated meanwhile, the rest of the rotated file is read first
+func (f *fileFollower) resumeOffset(file string) (int64, bool) {
+	if f.checkpoint == nil {
+		return 0, false
+	}
+
+	cp, ok := f.checkpoint.get(file)
+	if !ok {
+		return 0, false
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0, false
+	}
+
+	fields := logrus.Fields{
+		"path":   file,
+		"offset": cp.Offset,
+	}
+
+	dev, ino := utils.FileIdentity(fi)
+	identityKnown := cp.Device != 0 || cp.Inode != 0
+	if !identityKnown || (dev == cp.Device && ino == cp.Inode) {
+		if fi.Size() < cp.Offset {
+			utils.Logger.WithFields(fields).Info("File has been truncated since the last run, following from the beginning")
+			return 0, true
+		}
+
+		utils.Logger.WithFields(fields).Info("Resuming following file from the checkpoint")
+		return cp.Offset, true
+	}
+
+	rotated, ok := findRotatedFile(file, cp.Device, cp.Inode)
+	if ok && !utils.IsCompressedFile(rotated) {
+		fields["rotated_path"] = rotated
+		utils.Logger.WithFields(fields).Info("File has been rotated since the last run, reading the rest of the rotated file")
+		readFileFrom(f.ch, rotated, cp.Offset, file)
+	} else {
+		utils.Logger.WithFields(fields).Warn("File has been rotated since the last run and the rotated file can't be found, some lines might be missing")
+	}
+
+	return 0, true
+}
+
+// setRead records an offset read from a file with a known identity
+func (f *fileFollower) setRead(dev uint64, ino uint64, offset int64) {
+	if dev == 0 && ino == 0 {
+		return
+	}
+
+	f.mu.Lock()
+	f.read[fileIdentity{dev, ino}] = offset
+	f.mu.Unlock()
+}
+
+// renamedOffset returns an offset already read from the file when it's a followed file
+// under a new name, 0 and false otherwise
+func (f *fileFollower) renamedOffset(file string) (int64, bool) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0, false
+	}
+	dev, ino := utils.FileIdentity(fi)
+	if dev == 0 && ino == 0 {
+		return 0, false
+	}
+
+	f.mu.Lock()
+	offset, ok := f.read[fileIdentity{dev, ino}]
+	f.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"path":   file,
+		"offset": offset,
+	}).Info("Followed file has been renamed, following it from the offset already read")
+	return offset, true
+}
 
-		r, size, bar := utils.OpenFileForReadingWithProgress(file)
+func (f *fileFollower) isFollowed(file string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.followed[file]
+}
+
+// startTail follows changes of a file from the offset, a file renamed by rotation is polled,
+// an inotify watch of it would take over events of the watch added under the previous name
+// and the tail of the previous name would miss the file being recreated
+func (f *fileFollower) startTail(file string, offset int64, renamed bool) {
+	f.mu.Lock()
+	if f.followed[file] {
+		f.mu.Unlock()
+		return
+	}
+	f.followed[file] = true
+	f.mu.Unlock()
+
+	if utils.IsCompressedFile(file) {
+		// compressed files (rotated archives) are only read with `--full-read`
 		utils.Logger.WithFields(logrus.Fields{
-			"path":       file,
-			"size_bytes": size,
-		}).Info("Reading file")
+			"path": file,
+		}).Info("Skipping following changes of a compressed file")
+		return
+	}
 
-		utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
-			ProduceMessageString(ch, string(line.Line), models.MessageTypeStdout, &models.MessageOrigin{File: file})
+	utils.Logger.WithFields(logrus.Fields{
+		"path": file,
+	}).Info("Following file changes")
+
+	var dev, ino uint64
+	if fi, err := os.Stat(file); err == nil {
+		dev, ino = utils.FileIdentity(fi)
+	}
+	if f.checkpoint != nil {
+		f.checkpoint.update(file, dev, ino, offset)
+	}
+	f.setRead(dev, ino, offset)
+	f.status.update(file, func(st *models.FileStatus) {
+		st.State = models.FileStateFollowing
+		st.Offset = offset
+	})
+
+	go func() {
+		t, err := tail.TailFile(
+			file, tail.Config{Follow: true, ReOpen: true, Location: &tail.SeekInfo{Offset: offset, Whence: io.SeekStart}, Poll: renamed})
+		if err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"path":  file,
+				"error": err.Error(),
+			}).Error("Following file changes failed")
+			f.setError(file, err)
+			return
+		}
+
+		stop := context.AfterFunc(f.ctx, func() {
+			t.Stop()
 		})
-		bar.Finish()
+		defer stop()
+
+		go f.monitor(file, dev, ino)
+
+		lastOffset := offset
+		for line := range t.Lines {
+			ProduceMessageString(f.ch, line.Text, models.MessageTypeStdout, &models.MessageOrigin{File: file})
+			f.lineRead(file, line.SeekInfo.Offset)
+
+			// offsets go back only when the file has been reopened (rotated or truncated)
+			if line.SeekInfo.Offset < lastOffset {
+				if fi, err := os.Stat(file); err == nil {
+					dev, ino = utils.FileIdentity(fi)
+				}
+			}
+			lastOffset = line.SeekInfo.Offset
+			f.setRead(dev, ino, lastOffset)
+
+			if f.checkpoint != nil {
+				f.checkpoint.update(file, dev, ino, lastOffset)
+			}
+		}
 
+		if err := t.Err(); err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"path":  file,
+				"error": err.Error(),
+			}).Error("Following file changes stopped")
+			f.setError(file, err)
+		}
+	}()
+}
+
+func ReadFiles(ch chan models.Message, files []string) {
+	for _, file := range ExpandFilePaths(files) {
+		readFile(ch, file)
 	}
 }
+
+// readFile reads the whole file and returns the number of bytes consumed from it
+func readFile(ch chan models.Message, file string) int64 {
+	_, err := os.Stat(file)
+	if err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  file,
+			"error": err.Error(),
+		}).Error("Reading file failed")
+		return 0
+	}
+
+	r, size, bar := utils.OpenFileForReadingWithProgress(file)
+	utils.Logger.WithFields(logrus.Fields{
+		"path":       file,
+		"size_bytes": size,
+	}).Info("Reading file")
+
+	read := int64(0)
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		read += int64(len(line.Line)) + 1
+		ProduceMessageString(ch, string(line.Line), models.MessageTypeStdout, &models.MessageOrigin{File: file})
+	})
+	bar.Finish()
+
+	if read > size {
+		// the last line didn't end with a new line character
+		read = size
+	}
+
+	return read
+}
+
+// readFileFrom reads a plain file starting at the offset, messages are attributed to the origin file
+func readFileFrom(ch chan models.Message, file string, offset int64, origin string) {
+	r, err := os.Open(file)
+	if err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  file,
+			"error": err.Error(),
+		}).Error("Reading file failed")
+		return
+	}
+	defer r.Close()
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  file,
+			"error": err.Error(),
+		}).Error("Reading file failed")
+		return
+	}
+
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		if len(line.Line) == 0 {
+			return
+		}
+		ProduceMessageString(ch, string(line.Line), models.MessageTypeStdout, &models.MessageOrigin{File: origin})
+	})
+}
@@ -0,0 +1,161 @@
+package modes
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const CHECKPOINT_FLUSH_INTERVAL = 1 * time.Second
+
+// FileCheckpoint describes how far a followed file has been read, checkpoints are keyed by paths of files
+type FileCheckpoint struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+type checkpointFile struct {
+	Files map[string]FileCheckpoint `json:"files"`
+}
+
+type checkpointStore struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]FileCheckpoint
+
+	// incremented with every update, the checkpoint is dirty until the current version is saved
+	version uint64
+	saved   uint64
+}
+
+// loadCheckpoint reads offsets persisted by a previous run,
+// a missing checkpoint file is not an error
+func loadCheckpoint(path string) (*checkpointStore, error) {
+	c := &checkpointStore{
+		path:  path,
+		files: map[string]FileCheckpoint{},
+	}
+
+	bts, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cf := checkpointFile{}
+	if err := json.Unmarshal(bts, &cf); err != nil {
+		return nil, err
+	}
+	if cf.Files != nil {
+		c.files = cf.Files
+	}
+
+	return c, nil
+}
+
+func (c *checkpointStore) get(file string) (FileCheckpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp, ok := c.files[file]
+	return cp, ok
+}
+
+func (c *checkpointStore) update(file string, dev uint64, ino uint64, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files[file] = FileCheckpoint{Device: dev, Inode: ino, Offset: offset}
+	c.version++
+}
+
+// save writes the checkpoint atomically, a temporary file is renamed
+// over the previous one so a crash never leaves a partially written checkpoint,
+// a failed save is retried with the next one
+func (c *checkpointStore) save() error {
+	c.mu.Lock()
+	if c.version == c.saved {
+		c.mu.Unlock()
+		return nil
+	}
+	version := c.version
+	bts, err := json.Marshal(checkpointFile{Files: c.files})
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, bts, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.saved = version
+	c.mu.Unlock()
+
+	return nil
+}
+
+// startFlushLoop saves the checkpoint periodically and once more when the context is done
+func (c *checkpointStore) startFlushLoop(ctx context.Context) {
+	ticker := time.NewTicker(CHECKPOINT_FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			c.flush()
+			return
+		}
+		c.flush()
+	}
+}
+
+func (c *checkpointStore) flush() {
+	if err := c.save(); err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  c.path,
+			"error": err.Error(),
+		}).Error("Saving checkpoint failed")
+	}
+}
+
+// findRotatedFile looks for a file with a given identity in the directory of the followed file,
+// this is where rotation tools usually move the file (e.g. app.log -> app.log.1)
+func findRotatedFile(file string, dev uint64, ino uint64) (string, bool) {
+	dir := filepath.Dir(file)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		d, i := utils.FileIdentity(fi)
+		if d == dev && i == ino {
+			return filepath.Join(dir, entry.Name()), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,153 @@
+package modes
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveLines(t *testing.T, ch chan models.Message, count int) []string {
+	lines := []string{}
+	for len(lines) < count {
+		select {
+		case msg := <-ch:
+			lines = append(lines, msg.Content)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d lines, received %v", count, lines)
+		}
+	}
+	return lines
+}
+
+// waitForCheckpoint waits until the checkpoint is flushed with the offset of a file
+// and copies it, so a "restarted" follower doesn't share it with the previous one
+func waitForCheckpoint(t *testing.T, checkpoint string, file string, offset int64) string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		cp, err := loadCheckpoint(checkpoint)
+		if err == nil {
+			if c, ok := cp.get(file); ok && c.Offset == offset {
+				bts, err := os.ReadFile(checkpoint)
+				assert.Nil(t, err)
+				copied := checkpoint + ".copy"
+				assert.Nil(t, os.WriteFile(copied, bts, 0644))
+				return copied
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("checkpoint for %s with offset %d not saved", file, offset)
+	return ""
+}
+
+func appendToFile(t *testing.T, file string, content string) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(content)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestFollowFilesCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	checkpoint := dir + "/checkpoint.json"
+	appendToFile(t, file, "a\nb\n")
+
+	ch := make(chan models.Message, 10)
+	err := FollowFilesWithConfig(ch, []string{file}, FollowConfig{FullRead: true, CheckpointFile: checkpoint, Context: followContext(t)})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, receiveLines(t, ch, 2))
+
+	appendToFile(t, file, "c\n")
+	assert.Equal(t, []string{"c"}, receiveLines(t, ch, 1))
+	copied := waitForCheckpoint(t, checkpoint, file, 6)
+
+	// lines written while "logdy was not running"
+	appendToFile(t, file, "d\ne\n")
+
+	ch2 := make(chan models.Message, 10)
+	err = FollowFilesWithConfig(ch2, []string{file}, FollowConfig{FullRead: true, CheckpointFile: copied, Context: followContext(t)})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d", "e"}, receiveLines(t, ch2, 2))
+}
+
+func TestFollowFilesCheckpointRotated(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	checkpoint := dir + "/checkpoint.json"
+	appendToFile(t, file, "a\n")
+
+	ch := make(chan models.Message, 10)
+	err := FollowFilesWithConfig(ch, []string{file}, FollowConfig{CheckpointFile: checkpoint, Context: followContext(t)})
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+	appendToFile(t, file, "b\n")
+	assert.Equal(t, []string{"b"}, receiveLines(t, ch, 1))
+	copied := waitForCheckpoint(t, checkpoint, file, 4)
+
+	appendToFile(t, file, "c\n")
+	assert.Nil(t, os.Rename(file, dir+"/app.log.1"))
+	appendToFile(t, file, "d\n")
+
+	ch2 := make(chan models.Message, 10)
+	err = FollowFilesWithConfig(ch2, []string{file}, FollowConfig{CheckpointFile: copied, Context: followContext(t)})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d"}, receiveLines(t, ch2, 2))
+}
+
+func TestFollowFilesCheckpointSavedWhenStopped(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	checkpoint := dir + "/checkpoint.json"
+	appendToFile(t, file, "a\nb\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan models.Message, 10)
+	err := FollowFilesWithConfig(ch, []string{file}, FollowConfig{FullRead: true, CheckpointFile: checkpoint, Context: ctx})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, receiveLines(t, ch, 2))
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// saved right away, not after the flush interval
+	cp, err := loadCheckpoint(checkpoint)
+	assert.Nil(t, err)
+	c, ok := cp.get(file)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), c.Offset)
+
+	// following has stopped
+	appendToFile(t, file, "c\n")
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message after stop: %s", msg.Content)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestCheckpointSaveRetriedAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint := dir + "/missing/checkpoint.json"
+	cp, err := loadCheckpoint(checkpoint)
+	assert.Nil(t, err)
+
+	cp.update("/var/log/app.log", 1, 2, 100)
+	assert.NotNil(t, cp.save())
+
+	// the directory appears, the same offsets are saved with the next attempt
+	assert.Nil(t, os.Mkdir(dir+"/missing", 0755))
+	assert.Nil(t, cp.save())
+
+	loaded, err := loadCheckpoint(checkpoint)
+	assert.Nil(t, err)
+	c, ok := loaded.get("/var/log/app.log")
+	assert.True(t, ok)
+	assert.Equal(t, FileCheckpoint{Device: 1, Inode: 2, Offset: 100}, c)
+}
@@ -0,0 +1,170 @@
+package modes
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// a default interval of checks of followed files for truncation, rotation and deletion
+const FILE_DEFAULT_CHECK_INTERVAL = 1 * time.Second
+
+// FileStatusRegistry keeps a state of followed files
+type FileStatusRegistry struct {
+	mu    sync.Mutex
+	files map[string]*models.FileStatus
+}
+
+func NewFileStatusRegistry() *FileStatusRegistry {
+	return &FileStatusRegistry{
+		files: map[string]*models.FileStatus{},
+	}
+}
+
+func (r *FileStatusRegistry) update(file string, fn func(st *models.FileStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.files[file]
+	if !ok {
+		st = &models.FileStatus{Path: file}
+		r.files[file] = st
+	}
+	fn(st)
+}
+
+func (r *FileStatusRegistry) Get(file string) (models.FileStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.files[file]
+	if !ok {
+		return models.FileStatus{}, false
+	}
+	return *st, true
+}
+
+// Snapshot returns a copy of states of all of the files sorted by path
+func (r *FileStatusRegistry) Snapshot() []models.FileStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := make([]models.FileStatus, 0, len(r.files))
+	for _, st := range r.files {
+		files = append(files, *st)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files
+}
+
+func (f *fileFollower) setWaiting(file string) {
+	f.status.update(file, func(st *models.FileStatus) {
+		st.State = models.FileStateWaiting
+	})
+}
+
+func (f *fileFollower) setError(file string, err error) {
+	f.status.update(file, func(st *models.FileStatus) {
+		st.State = models.FileStateError
+		st.Error = err.Error()
+	})
+}
+
+func (f *fileFollower) lineRead(file string, offset int64) {
+	f.status.update(file, func(st *models.FileStatus) {
+		st.Offset = offset
+		st.LineCount++
+		st.LastLineAt = time.Now()
+	})
+}
+
+// emitEvent records the event and sends it as a message originating from the file
+func (f *fileFollower) emitEvent(file string, event models.FileEventType, message string) {
+	f.status.update(file, func(st *models.FileStatus) {
+		st.LastEvent = event
+		st.LastEventAt = time.Now()
+	})
+
+	utils.Logger.WithFields(logrus.Fields{
+		"path":  file,
+		"event": event,
+	}).Info(message)
+
+	bts, _ := json.Marshal(models.FileEvent{
+		Event:   event,
+		File:    file,
+		Message: message,
+	})
+	ProduceMessageString(f.ch, string(bts), models.MessageTypeEvent, &models.MessageOrigin{File: file})
+}
+
+// monitor periodically checks a followed file for truncation, rotation and deletion,
+// tail reopens the file on its own, the monitor makes these changes visible
+func (f *fileFollower) monitor(file string, dev uint64, ino uint64) {
+	var lastSize int64 = -1
+	identityKnown := dev != 0 || ino != 0
+
+	for {
+		select {
+		case <-time.After(f.config.CheckInterval):
+		case <-f.ctx.Done():
+			return
+		}
+
+		st, _ := f.status.Get(file)
+		fi, err := os.Stat(file)
+
+		if err != nil {
+			if st.State != models.FileStateDeleted {
+				f.status.update(file, func(st *models.FileStatus) {
+					st.State = models.FileStateDeleted
+					st.LastCheckAt = time.Now()
+				})
+				f.emitEvent(file, models.FileEventDeleted, "File has been deleted, waiting for it to be recreated")
+			}
+			lastSize = -1
+			continue
+		}
+
+		d, i := utils.FileIdentity(fi)
+		changedIdentity := identityKnown && (d != dev || i != ino)
+		dev, ino = d, i
+		identityKnown = dev != 0 || ino != 0
+
+		var event models.FileEventType
+		var message string
+		switch {
+		case st.State == models.FileStateDeleted:
+			event, message = models.FileEventRecreated, "File has been recreated, reading from the beginning"
+		case changedIdentity:
+			event, message = models.FileEventRotated, "File has been rotated, reading the new file from the beginning"
+		case fi.Size() < lastSize || fi.Size() < st.Offset:
+			event, message = models.FileEventTruncated, "File has been truncated, reading from the beginning"
+		}
+
+		lastSize = fi.Size()
+		f.status.update(file, func(st *models.FileStatus) {
+			if event != "" {
+				// tail reopens the file and reads it from the beginning
+				st.State = models.FileStateFollowing
+				st.Offset = 0
+			}
+			st.Size = fi.Size()
+			st.LastCheckAt = time.Now()
+		})
+
+		if event != "" {
+			f.emitEvent(file, event, message)
+		}
+	}
+}
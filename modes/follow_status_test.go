@@ -0,0 +1,72 @@
+package modes
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveEvent(t *testing.T, ch chan models.Message) models.FileEvent {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Mtype != models.MessageTypeEvent {
+				continue
+			}
+			ev := models.FileEvent{}
+			assert.Nil(t, json.Unmarshal(msg.JsonContent, &ev))
+			assert.Equal(t, ev.File, msg.Origin.File)
+			return ev
+		case <-deadline:
+			t.Fatal("file event not received")
+			return models.FileEvent{}
+		}
+	}
+}
+
+func TestFollowFilesEvents(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	appendToFile(t, file, "a\nb\n")
+
+	ch := make(chan models.Message, 100)
+	status := NewFileStatusRegistry()
+	err := FollowFilesWithConfig(ch, []string{file}, FollowConfig{Status: status, CheckInterval: 20 * time.Millisecond, Context: followContext(t)})
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	st, ok := status.Get(file)
+	assert.True(t, ok)
+	assert.Equal(t, models.FileStateFollowing, st.State)
+	assert.Equal(t, int64(4), st.Size)
+
+	assert.Nil(t, os.Truncate(file, 0))
+	assert.Equal(t, models.FileEventTruncated, receiveEvent(t, ch).Event)
+
+	assert.Nil(t, os.Rename(file, dir+"/app.log.1"))
+	assert.Equal(t, models.FileEventDeleted, receiveEvent(t, ch).Event)
+	st, _ = status.Get(file)
+	assert.Equal(t, models.FileStateDeleted, st.State)
+
+	appendToFile(t, file, "c\n")
+	assert.Equal(t, models.FileEventRecreated, receiveEvent(t, ch).Event)
+	st, _ = status.Get(file)
+	assert.Equal(t, models.FileStateFollowing, st.State)
+	assert.Equal(t, models.FileEventRecreated, st.LastEvent)
+}
+
+func TestFollowFilesWaitingStatus(t *testing.T) {
+	ch := make(chan models.Message, 10)
+	status := NewFileStatusRegistry()
+	file := t.TempDir() + "/later.log"
+
+	err := FollowFilesWithConfig(ch, []string{file}, FollowConfig{Status: status, Context: followContext(t)})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []models.FileStatus{{Path: file, State: models.FileStateWaiting}}, status.Snapshot())
+}
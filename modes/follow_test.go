@@ -11,6 +11,13 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// followContext stops following started by a test when the test ends
+func followContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
+
 func TestFollowFiles(t *testing.T) {
 
 	ch := make(chan models.Message)
@@ -33,7 +40,7 @@ func TestFollowFiles(t *testing.T) {
 
 	assert.Equal(t, err, nil)
 
-	go FollowFiles(ch, []string{f.Name()})
+	go FollowFilesWithConfig(ch, []string{f.Name()}, FollowConfig{Context: ctx})
 
 	received := 0
 	for received < 20 {
@@ -46,3 +53,108 @@ func TestFollowFiles(t *testing.T) {
 	assert.GreaterOrEqual(t, received, 20)
 
 }
+
+func TestFollowFilesGlob(t *testing.T) {
+
+	ch := make(chan models.Message, 10)
+	dir := t.TempDir()
+
+	existing := dir + "/existing.log"
+	err := os.WriteFile(existing, []byte{}, 0644)
+	assert.Nil(t, err)
+	err = os.WriteFile(dir+"/ignored.txt", []byte{}, 0644)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{existing}, ExpandFilePaths([]string{dir + "/*.log"}))
+	assert.Equal(t, 2, len(ExpandFilePaths([]string{dir})))
+
+	FollowFilesWithConfig(ch, []string{dir + "/*.log"}, FollowConfig{Context: followContext(t)})
+	time.Sleep(100 * time.Millisecond)
+
+	err = os.WriteFile(dir+"/ignored.txt", []byte("ignored\n"), 0644)
+	assert.Nil(t, err)
+	err = os.WriteFile(dir+"/created.log", []byte("created\n"), 0644)
+	assert.Nil(t, err)
+
+	select {
+	case msg := <-ch:
+		assert.Equal(t, "created", msg.Content)
+		assert.Equal(t, dir+"/created.log", msg.Origin.File)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message from a newly created file not received")
+	}
+}
+
+func TestFollowFilesGlobNewSubdirectory(t *testing.T) {
+
+	ch := make(chan models.Message, 10)
+	dir := t.TempDir()
+
+	FollowFilesWithConfig(ch, []string{dir + "/*/app/*.log"}, FollowConfig{Context: followContext(t)})
+	time.Sleep(100 * time.Millisecond)
+
+	// the directories matched by the pattern don't exist on start
+	err := os.MkdirAll(dir+"/service/app", 0755)
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+	err = os.WriteFile(dir+"/service/app/created.log", []byte("created\n"), 0644)
+	assert.Nil(t, err)
+
+	select {
+	case msg := <-ch:
+		assert.Equal(t, "created", msg.Content)
+		assert.Equal(t, dir+"/service/app/created.log", msg.Origin.File)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message from a file in a newly created directory not received")
+	}
+}
+
+func TestFollowFilesMissing(t *testing.T) {
+
+	ch := make(chan models.Message, 10)
+	file := t.TempDir() + "/later.log"
+
+	FollowFilesWithConfig(ch, []string{file}, FollowConfig{Context: followContext(t)})
+	time.Sleep(100 * time.Millisecond)
+
+	err := os.WriteFile(file, []byte("appeared\n"), 0644)
+	assert.Nil(t, err)
+
+	select {
+	case msg := <-ch:
+		assert.Equal(t, "appeared", msg.Content)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message from a file created after start not received")
+	}
+}
+
+func TestFollowFilesLastLines(t *testing.T) {
+
+	ch := make(chan models.Message, 10)
+	file := t.TempDir() + "/app.log"
+	err := os.WriteFile(file, []byte("a\nb\nc\n"), 0644)
+	assert.Nil(t, err)
+
+	err = FollowFilesWithConfig(ch, []string{file}, FollowConfig{Lines: 2, Context: followContext(t)})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"b", "c"}, receiveLines(t, ch, 2))
+
+	err = FollowFilesWithConfig(ch, []string{file}, FollowConfig{Lines: 2, FullRead: true})
+	assert.NotNil(t, err)
+}
+
+func TestFollowFilesSince(t *testing.T) {
+
+	ch := make(chan models.Message, 10)
+	file := t.TempDir() + "/app.log"
+	old := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	recent := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	err := os.WriteFile(file, []byte(old+" a\n"+recent+" b\n"), 0644)
+	assert.Nil(t, err)
+
+	err = FollowFilesWithConfig(ch, []string{file}, FollowConfig{Since: 30 * time.Minute, Context: followContext(t)})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{recent + " b"}, receiveLines(t, ch, 1))
+}
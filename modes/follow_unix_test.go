@@ -0,0 +1,60 @@
+//go:build unix
+
+package modes
+
+import (
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandFilePathsNamedPipe(t *testing.T) {
+	dir := t.TempDir()
+	pipe := dir + "/pipe"
+	assert.Nil(t, syscall.Mkfifo(pipe, 0644))
+
+	assert.Equal(t, []string{pipe}, ExpandFilePaths([]string{pipe}))
+	assert.Equal(t, []string{pipe}, ExpandFilePaths([]string{dir}))
+}
+
+func TestFollowFilesDirectoryRotation(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	appendToFile(t, file, "a\n")
+
+	ch := make(chan models.Message, 10)
+	err := FollowFilesWithConfig(ch, []string{dir}, FollowConfig{Context: followContext(t)})
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	appendToFile(t, file, "b\n")
+	assert.Equal(t, []string{"b"}, receiveLines(t, ch, 1))
+
+	// logrotate renames the file and creates a new one
+	assert.Nil(t, os.Rename(file, dir+"/app.log.1"))
+	time.Sleep(100 * time.Millisecond)
+	appendToFile(t, dir+"/app.log.1", "c\n")
+	appendToFile(t, file, "d\n")
+
+	lines := []string{}
+	deadline := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case msg := <-ch:
+			if msg.Mtype == models.MessageTypeStdout {
+				lines = append(lines, msg.Content)
+			}
+		case <-deadline:
+			done = true
+		}
+	}
+
+	// lines already read under the previous name are not read again
+	slices.Sort(lines)
+	assert.Equal(t, []string{"c", "d"}, lines)
+}
@@ -1,6 +1,7 @@
 package modes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -13,15 +14,101 @@ import (
 	"github.com/valyala/fastjson"
 )
 
+// Deprecated: use ProduceOptions.Fallthrough, lines of all instances are written to stdout/stderr when it's set
 var FallthroughGlobal = false
+
+// Deprecated: use ProduceOptions.DisableANSICodeStripping, ANSI codes are kept in lines of all instances when it's set
 var DisableANSICodeStripping = false
 
+// ProduceOptions control how produced messages are processed before they reach clients
+type ProduceOptions struct {
+	// Whether lines should be written to stdout/stderr as well
+	Fallthrough bool
+
+	// Whether ANSI codes (e.g. colors) should be kept in lines
+	DisableANSICodeStripping bool
+}
+
+// ProcessProducedMessages applies options to messages produced to the channel. When the context is done,
+// messages already waiting in the channel are processed and the returned channel is closed,
+// the input channel is never closed so producers that are still running don't panic.
+func ProcessProducedMessages(ch chan models.Message, opts ProduceOptions, ctx context.Context) chan models.Message {
+	out := make(chan models.Message, 1000)
+
+	process := func(msg models.Message) {
+		if !opts.DisableANSICodeStripping && !DisableANSICodeStripping {
+			stripAnsiMessage(&msg)
+		}
+
+		if opts.Fallthrough || FallthroughGlobal {
+			if msg.Mtype == models.MessageTypeStdout {
+				fmt.Fprintln(os.Stdout, msg.Content)
+			}
+			if msg.Mtype == models.MessageTypeStderr {
+				fmt.Fprintln(os.Stderr, msg.Content)
+			}
+		}
+
+		out <- msg
+	}
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case msg := <-ch:
+				process(msg)
+			case <-ctx.Done():
+				for {
+					select {
+					case msg := <-ch:
+						process(msg)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+func stripAnsiMessage(msg *models.Message) {
+	line := utils.StripAnsi(msg.Content)
+	if line == msg.Content {
+		return
+	}
+
+	// a colored JSON is valid only after the codes are stripped
+	msg.Content = line
+	msg.IsJson = fastjson.Validate(line) == nil
+	msg.JsonContent = nil
+	if msg.IsJson {
+		msg.JsonContent = json.RawMessage(line)
+	}
+}
+
 func ProduceMessageStringTimestamped(ch chan models.Message, line string, mt models.LogType, mo *models.MessageOrigin, ts time.Time) {
+	produceMessage(ch, line, mt, mo, ts, "")
+}
 
-	if !DisableANSICodeStripping {
-		line = utils.StripAnsi(line)
+// ProduceMessageWithOptions produces a message with a type, time, source, labels and level given in options
+func ProduceMessageWithOptions(ch chan models.Message, line string, opts models.LogOptions) {
+	if opts.Type == 0 {
+		opts.Type = models.MessageTypeStdout
+	}
+	if opts.Ts.IsZero() {
+		opts.Ts = time.Now()
 	}
 
+	produceMessage(ch, line, opts.Type, &models.MessageOrigin{
+		ApiSource: opts.Source,
+		Labels:    opts.Labels,
+	}, opts.Ts, opts.Level)
+}
+
+func produceMessage(ch chan models.Message, line string, mt models.LogType, mo *models.MessageOrigin, ts time.Time, level string) {
 	validJson := fastjson.Validate(line)
 	var cs json.RawMessage
 	if validJson == nil {
@@ -38,19 +125,13 @@ func ProduceMessageStringTimestamped(ch chan models.Message, line string, mt mod
 		if mo.File != "" {
 			fields["origin_file"] = mo.File
 		}
+		if mo.ApiSource != "" {
+			fields["origin_source"] = mo.ApiSource
+		}
 	}
 
 	utils.Logger.WithFields(fields).Debug("Producing message")
 
-	if FallthroughGlobal {
-		if mt == models.MessageTypeStdout {
-			fmt.Fprintln(os.Stdout, line)
-		}
-		if mt == models.MessageTypeStderr {
-			fmt.Fprintln(os.Stderr, line)
-		}
-	}
-
 	ch <- models.Message{
 		Id:          strconv.FormatInt(time.Now().UnixMicro(), 10),
 		Mtype:       mt,
@@ -60,6 +141,7 @@ func ProduceMessageStringTimestamped(ch chan models.Message, line string, mt mod
 		BaseMessage: models.BaseMessage{MessageType: "log"},
 		Origin:      mo,
 		Ts:          ts.UnixMilli(),
+		Level:       level,
 	}
 }
 
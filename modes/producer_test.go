@@ -0,0 +1,51 @@
+package modes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProduceMessageWithOptions(t *testing.T) {
+	ch := make(chan models.Message, 2)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	ProduceMessageWithOptions(ch, `{"msg":"done"}`, models.LogOptions{
+		Type:   models.MessageTypeStderr,
+		Ts:     ts,
+		Source: "billing-job",
+		Labels: map[string]string{"tenant": "acme"},
+		Level:  "error",
+	})
+	ProduceMessageWithOptions(ch, "plain", models.LogOptions{})
+
+	msg := <-ch
+	assert.Equal(t, models.MessageTypeStderr, msg.Mtype)
+	assert.Equal(t, ts.UnixMilli(), msg.Ts)
+	assert.Equal(t, "billing-job", msg.Origin.ApiSource)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, msg.Origin.Labels)
+	assert.Equal(t, "error", msg.Level)
+	assert.True(t, msg.IsJson)
+
+	msg = <-ch
+	assert.Equal(t, models.MessageTypeStdout, msg.Mtype)
+	assert.WithinDuration(t, time.Now(), time.UnixMilli(msg.Ts), time.Second)
+	assert.Equal(t, "", msg.Level)
+	assert.False(t, msg.IsJson)
+}
+
+func TestProcessProducedMessagesDeprecatedGlobals(t *testing.T) {
+	DisableANSICodeStripping = true
+	defer func() { DisableANSICodeStripping = false }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan models.Message, 1)
+	out := ProcessProducedMessages(ch, ProduceOptions{}, ctx)
+
+	ProduceMessageString(ch, "\033[31mred\033[0m", models.MessageTypeStdout, nil)
+	assert.Equal(t, "\033[31mred\033[0m", (<-out).Content)
+}
@@ -2,6 +2,7 @@ package modes
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"os"
 
@@ -10,8 +11,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func handleConnection(conn net.Conn, ch chan models.Message, port string) {
+func handleConnection(conn net.Conn, ch chan models.Message, port string, ctx context.Context) {
 	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
 
 	// Create a new bufio.Scanner to read lines from the connection
 	scanner := bufio.NewScanner(conn)
@@ -22,13 +27,15 @@ func handleConnection(conn net.Conn, ch chan models.Message, port string) {
 	}
 }
 
-func StartSocketServers(ch chan models.Message, ip string, ports []string) {
+// StartSocketServers listens on the ports until the context is done,
+// then the listeners and accepted connections are closed
+func StartSocketServers(ch chan models.Message, ip string, ports []string, ctx context.Context) {
 	for _, port := range ports {
-		go startSocketServer(ch, ip, port)
+		go startSocketServer(ch, ip, port, ctx)
 	}
 }
 
-func startSocketServer(ch chan models.Message, ip string, port string) {
+func startSocketServer(ch chan models.Message, ip string, port string, ctx context.Context) {
 
 	addr := ip + ":" + port
 	// Start the TCP server
@@ -38,6 +45,10 @@ func startSocketServer(ch chan models.Message, ip string, port string) {
 		os.Exit(1)
 	}
 	defer server.Close()
+	stop := context.AfterFunc(ctx, func() {
+		server.Close()
+	})
+	defer stop()
 
 	utils.Logger.WithFields(logrus.Fields{
 		"address": addr,
@@ -46,12 +57,18 @@ func startSocketServer(ch chan models.Message, ip string, port string) {
 	// Accept incoming connections and handle them in a separate goroutine
 	for {
 		conn, err := server.Accept()
+		if ctx.Err() != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"address": addr,
+			}).Info("TCP Server stopped")
+			return
+		}
 		if err != nil {
 			utils.Logger.Error("Error accepting connection:", err)
 			continue
 		}
 
 		utils.Logger.Info("Connection accepted")
-		go handleConnection(conn, ch, port)
+		go handleConnection(conn, ch, port, ctx)
 	}
 }
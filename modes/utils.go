@@ -1,8 +1,10 @@
 package modes
 
 import (
+	"bytes"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -29,18 +31,20 @@ func UtilsCutByLineNumber(file string, count int, offset int, outFile string) {
 		return
 	}
 
-	var size int64
-	var bar *pb.ProgressBar
-	var r io.Reader
-	if outFile == "" {
-		r, size = utils.OpenFileForReading(file)
-	} else {
-		r, size, bar = utils.OpenFileForReadingWithProgress(file)
+	// with an index, reading starts at the closest indexed line instead of the beginning
+	var startOffset int64
+	var startLine int64
+	if idx, ok := utils.LoadLineIndex(file); ok && offset > 0 {
+		startOffset, startLine = idx.LineOffset(int64(offset - 1))
 	}
 
+	r, size, bar, closeFile := openFileAt(file, startOffset, outFile != "")
+	defer closeFile()
+
 	utils.Logger.WithFields(logrus.Fields{
-		"path":       file,
-		"size_bytes": size,
+		"path":         file,
+		"size_bytes":   size,
+		"offset_bytes": startOffset,
 	}).Info("Reading file")
 
 	var f *os.File
@@ -54,7 +58,7 @@ func UtilsCutByLineNumber(file string, count int, offset int, outFile string) {
 
 	started := false
 	stopped := false
-	ln := 0
+	ln := int(startLine)
 	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
 		ln++
 
@@ -95,6 +99,54 @@ func UtilsCutByLineNumber(file string, count int, offset int, outFile string) {
 }
 
 func UtilsCutByString(file string, start string, end string, caseInsensitive bool, outFile string, dateFormat string, searchOffset int) {
+	if dateFormat != "" {
+		UtilsCutByDate(file, start, end, dateFormat, searchOffset, outFile)
+		return
+	}
+
+	UtilsCutByStringWithOptions(file, start, end, outFile, CutByStringOptions{CaseInsensitive: caseInsensitive})
+}
+
+// CutByStringOptions changes how ranges are found and written by UtilsCutByStringWithOptions
+type CutByStringOptions struct {
+	CaseInsensitive bool
+	Regex           bool   // start and end are regular expressions
+	All             bool   // every range is written, not only the first one
+	ExcludeStart    bool   // a line matching start is not written
+	ExcludeEnd      bool   // a line matching end is not written
+	Context         int    // number of lines before the start written as well
+	Separator       string // a line written between ranges
+}
+
+func stringMatcher(pattern string, opts CutByStringOptions) func(line []byte) bool {
+	if opts.Regex {
+		if opts.CaseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			panic("Error while parsing pattern: " + err.Error())
+		}
+		return re.Match
+	}
+
+	if opts.CaseInsensitive {
+		lower := []byte(strings.ToLower(pattern))
+		return func(line []byte) bool {
+			return bytes.Contains(bytes.ToLower(line), lower)
+		}
+	}
+
+	bpattern := []byte(pattern)
+	return func(line []byte) bool {
+		return bytes.Contains(line, bpattern)
+	}
+}
+
+// UtilsCutByStringWithOptions cuts a file by lines containing start and end strings (or matching
+// regular expressions) into a new file or standard output, a range ends with a line matching end
+// (this can be the start line) or with the end of the file
+func UtilsCutByStringWithOptions(file string, start string, end string, outFile string, opts CutByStringOptions) {
 	_, err := os.Stat(file)
 	if err != nil {
 		utils.Logger.WithFields(logrus.Fields{
@@ -104,6 +156,9 @@ func UtilsCutByString(file string, start string, end string, caseInsensitive boo
 		return
 	}
 
+	matchStart := stringMatcher(start, opts)
+	matchEnd := stringMatcher(end, opts)
+
 	var size int64
 	var bar *pb.ProgressBar
 	var r io.Reader
@@ -118,60 +173,195 @@ func UtilsCutByString(file string, start string, end string, caseInsensitive boo
 		"size_bytes": size,
 	}).Info("Reading file")
 
-	if caseInsensitive {
-		start = strings.ToLower(start)
-		end = strings.ToLower(end)
-	}
-
-	var f *os.File
+	var out io.Writer = os.Stdout
 	if outFile != "" {
-		f, err = os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY, 0644)
+		f, err := os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			panic(err)
 		}
 		defer f.Close() // Close the file when we're done
+		out = f
 	}
 
-	var startDate time.Time
-	var endDate time.Time
-
-	if dateFormat != "" {
-		startDate, err = time.Parse(dateFormat, start)
-		if err != nil {
-			panic("Error while parsing input `start` date: " + err.Error())
-		}
-		endDate, err = time.Parse(dateFormat, end)
-		if err != nil {
-			panic("Error while parsing input `end` date: " + err.Error())
-		}
+	write := func(line []byte) {
+		out.Write(line)
+		out.Write([]byte{'\n'})
 	}
 
+	// last lines before a range, written as its context
+	context := [][]byte{}
+	ranges := 0
 	started := false
 	stopped := false
 	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
 		if stopped {
 			return
 		}
-		ln := string(line.Line)
 
-		if caseInsensitive {
-			ln = strings.ToLower(ln)
-		}
+		isStart := false
+		if !started {
+			if !matchStart(line.Line) {
+				if opts.Context > 0 {
+					if len(context) == opts.Context {
+						context = context[1:]
+					}
+					context = append(context, append([]byte{}, line.Line...))
+				}
+				return
+			}
 
-		if dateFormat == "" && strings.Contains(ln, start) {
 			started = true
+			isStart = true
+			if ranges > 0 && opts.Separator != "" {
+				write([]byte(opts.Separator))
+			}
+			ranges++
+
+			for _, l := range context {
+				write(l)
+			}
+			context = context[:0]
 		}
 
-		if dateFormat != "" {
-			t, err := time.Parse(dateFormat, ln[searchOffset:searchOffset+len(dateFormat)])
+		// the start line can end a range as well
+		isEnd := matchEnd(line.Line)
+		if !(isStart && opts.ExcludeStart) && !(isEnd && opts.ExcludeEnd) {
+			write(line.Line)
+		}
 
-			if err != nil {
-				return
-			}
+		if !isEnd {
+			return
+		}
 
-			if !t.IsZero() && (t.After(startDate) || t.Equal(startDate)) {
-				started = true
-			}
+		started = false
+		if !opts.All {
+			cancel()
+			stopped = true
+		}
+	})
+
+	if outFile != "" {
+		bar.Finish()
+	}
+}
+
+// number of lines sampled to check whether the file is sorted by time
+const cutByDateSortSamples = 64
+
+// UtilsCutByDate cuts a file by a start and end date, a date is parsed using the format
+// at the offset of each line. For files sorted by time, the start position is found with
+// a binary search, otherwise the file is scanned from the beginning.
+func UtilsCutByDate(file string, start string, end string, dateFormat string, searchOffset int, outFile string) {
+	startDate, err := time.Parse(dateFormat, start)
+	if err != nil {
+		panic("Error while parsing input `start` date: " + err.Error())
+	}
+	endDate, err := time.Parse(dateFormat, end)
+	if err != nil {
+		panic("Error while parsing input `end` date: " + err.Error())
+	}
+
+	cutByTime(file, startDate, endDate, utils.LayoutTimeExtractor(dateFormat, searchOffset), outFile)
+}
+
+// number of lines from the beginning of a file used to detect a timestamp format
+const cutByDateDetectLines = 100
+
+// UtilsCutByDateAuto cuts a file by a start and end date, the location and format of a timestamp
+// is detected from the first lines of the file unless a JSON field holding it is given.
+// The start and end can be given in any of the common formats or as relative expressions, e.g. `-2h`.
+func UtilsCutByDateAuto(file string, start string, end string, timeField string, outFile string) {
+	now := time.Now()
+	startDate, err := utils.ParseTimeExpression(start, now)
+	if err != nil {
+		panic("Error while parsing input `start` date: " + err.Error())
+	}
+	endDate, err := utils.ParseTimeExpression(end, now)
+	if err != nil {
+		panic("Error while parsing input `end` date: " + err.Error())
+	}
+
+	var extractor *utils.TimeExtractor
+	if timeField != "" {
+		extractor = utils.JsonFieldTimeExtractor(timeField)
+	} else {
+		extractor = detectFileTimeExtractor(file)
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"path":   file,
+		"format": extractor.Name,
+		"start":  startDate.Format(time.RFC3339),
+		"end":    endDate.Format(time.RFC3339),
+	}).Info("Cutting file by date")
+
+	cutByTime(file, startDate, endDate, extractor, outFile)
+}
+
+// detectFileTimeExtractor detects a timestamp format from the first lines of a file,
+// when none of the formats matches, all of them are tried on each line
+func detectFileTimeExtractor(file string) *utils.TimeExtractor {
+	r, _ := utils.OpenFileForReading(file)
+
+	lines := [][]byte{}
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		if len(lines) >= cutByDateDetectLines {
+			cancel()
+			return
+		}
+		lines = append(lines, append([]byte{}, line.Line...))
+	})
+
+	extractor, ok := utils.DetectTimeExtractor(lines)
+	if !ok {
+		return utils.AnyTimeExtractor()
+	}
+
+	return extractor
+}
+
+// cutByTime writes lines between the start and end date, lines without a date
+// inside of the range are written as well
+func cutByTime(file string, startDate time.Time, endDate time.Time, extractor *utils.TimeExtractor, outFile string) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  file,
+			"error": err.Error(),
+		}).Error("Reading file failed")
+		return
+	}
+
+	offset := seekToDate(file, fi.Size(), startDate, extractor)
+
+	r, size, bar, closeFile := openFileAt(file, offset, outFile != "")
+	defer closeFile()
+
+	utils.Logger.WithFields(logrus.Fields{
+		"path":         file,
+		"size_bytes":   size,
+		"offset_bytes": offset,
+	}).Info("Reading file")
+
+	var f *os.File
+	if outFile != "" {
+		f, err = os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close() // Close the file when we're done
+	}
+
+	started := false
+	stopped := false
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		if stopped {
+			return
+		}
+
+		t, ok := extractor.Extract(line.Line)
+		if !started && ok && !t.Before(startDate) {
+			started = true
 		}
 
 		if !started {
@@ -184,33 +374,104 @@ func UtilsCutByString(file string, start string, end string, caseInsensitive boo
 		} else {
 			f.Write(line.Line)
 			f.Write([]byte{'\n'})
-			if err != nil {
-				panic(err)
-			}
 		}
 
-		if dateFormat == "" && strings.Contains(ln, end) {
+		if ok && !t.Before(endDate) {
 			cancel()
 			stopped = true
 			return
 		}
-
-		if dateFormat != "" {
-			t, err := time.Parse(dateFormat, ln[searchOffset:searchOffset+len(dateFormat)])
-
-			if err != nil {
-				return
-			}
-
-			if !t.IsZero() && (t.After(endDate) || t.Equal(endDate)) {
-				cancel()
-				stopped = true
-				return
-			}
-		}
 	})
 
 	if outFile != "" {
 		bar.Finish()
 	}
 }
+
+// openFileAt opens a file for reading starting at the offset, a file is decompressed when read
+// from the beginning, otherwise it has to be a plain file
+func openFileAt(file string, offset int64, withProgress bool) (io.Reader, int64, *pb.ProgressBar, func()) {
+	if offset <= 0 {
+		if withProgress {
+			r, size, bar := utils.OpenFileForReadingWithProgress(file)
+			return r, size, bar, func() {}
+		}
+		r, size := utils.OpenFileForReading(file)
+		return r, size, nil, func() {}
+	}
+
+	fl, err := os.Open(file)
+	if err != nil {
+		panic(err)
+	}
+	fi, err := fl.Stat()
+	if err != nil {
+		panic(err)
+	}
+
+	size := fi.Size() - offset
+	var r io.Reader = io.NewSectionReader(fl, offset, size)
+	var bar *pb.ProgressBar
+	if withProgress {
+		bar = pb.Full.Start64(size)
+		r = bar.NewProxyReader(r)
+	}
+
+	return r, size, bar, func() { fl.Close() }
+}
+
+// seekToDate finds an offset of the first line not older than the date,
+// 0 is returned when the file can't be searched (compressed or not sorted by time)
+func seekToDate(file string, size int64, date time.Time, extractor *utils.TimeExtractor) int64 {
+	if utils.IsCompressedFile(file) {
+		return 0
+	}
+
+	// lines are scanned from the indexed line, those before the date are skipped,
+	// an index with times extracted differently is ignored
+	if idx, ok := utils.LoadLineIndex(file); ok && idx.TimesExtractedWith(extractor) && idx.SortedByTime() {
+		utils.Logger.WithField("path", file).Info("Seeking using line index")
+		return idx.TimeOffset(date)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	sorted, err := utils.IsSortedByTime(f, size, cutByDateSortSamples, extractor.Extract)
+	if err != nil || !sorted {
+		utils.Logger.WithField("path", file).Info("Lines are not sorted by time, scanning the whole file")
+		return 0
+	}
+
+	offset, err := utils.SearchFileByTime(f, size, date, extractor.Extract)
+	if err != nil {
+		return 0
+	}
+
+	return offset
+}
+
+// UtilsIndex builds a sidecar index of line offsets of a plain file, it's used automatically
+// by `cut-by-line-number` and `follow --since` to seek in the file without reading it from the beginning.
+// Times are extracted in any of the supported formats, `cut-by-date` only uses them
+// when it extracts times the same way (a format or a time field isn't given nor detected).
+func UtilsIndex(file string, interval int, withTimes bool) (*utils.LineIndex, error) {
+	var extractor *utils.TimeExtractor
+	if withTimes {
+		extractor = utils.AnyTimeExtractor()
+	}
+
+	idx, err := utils.BuildLineIndex(file, interval, extractor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := idx.Write(file); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
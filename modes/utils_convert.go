@@ -0,0 +1,404 @@
+package modes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fastjson"
+)
+
+const ConvertFormatJson = "json"
+const ConvertFormatLogfmt = "logfmt"
+const ConvertFormatCsv = "csv"
+const ConvertFormatTsv = "tsv"
+
+// messages written by `--append-to-file`
+const ConvertFormatLogdy = "logdy"
+
+var convertFormats = []string{ConvertFormatJson, ConvertFormatLogfmt, ConvertFormatCsv, ConvertFormatTsv, ConvertFormatLogdy}
+
+// a key used for lines that can't be parsed in the input format
+const convertLineKey = "line"
+
+var jsonNumberRegex = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// convertRecord is a set of fields in the order they appeared in the input,
+// values are strings, json.Number, bool, nil or json.RawMessage (objects and arrays)
+type convertRecord struct {
+	keys   []string
+	values map[string]any
+}
+
+func newConvertRecord() *convertRecord {
+	return &convertRecord{values: map[string]any{}}
+}
+
+func (r *convertRecord) set(key string, value any) {
+	if _, ok := r.values[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.values[key] = value
+}
+
+// inferValue turns a text (an unquoted logfmt value or a CSV cell) into a number or bool when possible
+func inferValue(s string) any {
+	switch {
+	case jsonNumberRegex.MatchString(s):
+		return json.Number(s)
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	}
+	return s
+}
+
+func jsonToRecord(v *fastjson.Value) *convertRecord {
+	rec := newConvertRecord()
+	obj, _ := v.Object()
+	obj.Visit(func(k []byte, fv *fastjson.Value) {
+		var value any
+		switch fv.Type() {
+		case fastjson.TypeString:
+			value = string(fv.GetStringBytes())
+		case fastjson.TypeNumber:
+			value = json.Number(fv.MarshalTo(nil))
+		case fastjson.TypeTrue:
+			value = true
+		case fastjson.TypeFalse:
+			value = false
+		case fastjson.TypeNull:
+			value = nil
+		default:
+			value = json.RawMessage(fv.MarshalTo(nil))
+		}
+		rec.set(string(k), value)
+	})
+	return rec
+}
+
+func lineToRecord(line string) *convertRecord {
+	rec := newConvertRecord()
+	rec.set(convertLineKey, line)
+	return rec
+}
+
+func parseJsonRecord(line []byte) *convertRecord {
+	v, err := fastjson.ParseBytes(line)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		return lineToRecord(string(line))
+	}
+	return jsonToRecord(v)
+}
+
+// parseLogfmtRecord parses a line like `level=info msg="hello world" took=12`,
+// a key without a value is set to true
+func parseLogfmtRecord(line []byte) *convertRecord {
+	s := string(line)
+	if !strings.Contains(s, "=") {
+		return lineToRecord(s)
+	}
+
+	rec := newConvertRecord()
+	i := 0
+
+	for i < len(s) {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' {
+			i++
+		}
+		key := s[start:i]
+		if key == "" {
+			i++
+			continue
+		}
+
+		if i >= len(s) || s[i] == ' ' {
+			rec.set(key, true)
+			continue
+		}
+		i++ // skip `=`
+
+		if i < len(s) && s[i] == '"' {
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				end = len(s) - 1
+			}
+			value, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				value = strings.Trim(s[i:end+1], `"`)
+			}
+			rec.set(key, value)
+			i = end + 1
+			continue
+		}
+
+		start = i
+		for i < len(s) && s[i] != ' ' {
+			i++
+		}
+		rec.set(key, inferValue(s[start:i]))
+	}
+
+	if len(rec.keys) == 0 {
+		return lineToRecord(s)
+	}
+	return rec
+}
+
+// parseLogdyRecord reads a content of a message written by `--append-to-file`
+func parseLogdyRecord(line []byte) *convertRecord {
+	msg := models.Message{}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return lineToRecord(string(line))
+	}
+
+	if msg.IsJson {
+		return parseJsonRecord([]byte(msg.Content))
+	}
+	return lineToRecord(msg.Content)
+}
+
+// readConvertRecords reads records from the input in a given format
+func readConvertRecords(r io.Reader, format string, fn func(rec *convertRecord)) error {
+	if format == ConvertFormatCsv || format == ConvertFormatTsv {
+		cr := csv.NewReader(r)
+		if format == ConvertFormatTsv {
+			cr.Comma = '\t'
+		}
+		cr.FieldsPerRecord = -1
+
+		header, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for {
+			row, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			rec := newConvertRecord()
+			for i, key := range header {
+				if i < len(row) {
+					rec.set(key, inferValue(row[i]))
+				}
+			}
+			fn(rec)
+		}
+	}
+
+	parse := map[string]func(line []byte) *convertRecord{
+		ConvertFormatJson:   parseJsonRecord,
+		ConvertFormatLogfmt: parseLogfmtRecord,
+		ConvertFormatLogdy:  parseLogdyRecord,
+	}[format]
+
+	return utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		if len(bytes.TrimSpace(line.Line)) == 0 {
+			return
+		}
+		fn(parse(line.Line))
+	})
+}
+
+func recordToJson(rec *convertRecord) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, key := range rec.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, _ := json.Marshal(rec.values[key])
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// recordValueString returns a text form of a value, strings are not quoted
+func recordValueString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	bts, _ := json.Marshal(value)
+	return string(bts)
+}
+
+func recordToLogfmt(rec *convertRecord) []byte {
+	buf := bytes.Buffer{}
+	for i, key := range rec.keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+
+		s := recordValueString(rec.values[key])
+		_, isString := rec.values[key].(string)
+		if (isString && s == "") || strings.ContainsAny(s, " =\"\t\r\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+	return buf.Bytes()
+}
+
+func recordToLogdy(rec *convertRecord) []byte {
+	content := string(recordToJson(rec))
+	if len(rec.keys) == 1 && rec.keys[0] == convertLineKey {
+		if line, ok := rec.values[convertLineKey].(string); ok {
+			content = line
+		}
+	}
+
+	ts, ok := utils.ParseLineTime([]byte(content))
+	if !ok {
+		ts = time.Now()
+	}
+
+	isJson := fastjson.Validate(content) == nil
+	var cs json.RawMessage
+	if isJson {
+		cs = json.RawMessage(content)
+	}
+
+	bts, _ := json.Marshal(models.Message{
+		Id:          strconv.FormatInt(time.Now().UnixMicro(), 10),
+		Mtype:       models.MessageTypeStdout,
+		Content:     content,
+		JsonContent: cs,
+		IsJson:      isJson,
+		BaseMessage: models.BaseMessage{MessageType: "log"},
+		Ts:          ts.UnixMilli(),
+	})
+	return bts
+}
+
+func isConvertFormat(format string) bool {
+	for _, f := range convertFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// UtilsConvert converts a file (plain or compressed) between JSON lines, logfmt, CSV, TSV and messages
+// written by `--append-to-file`. CSV and TSV input needs a header, CSV and TSV output has columns
+// of the first record unless they are given.
+func UtilsConvert(file string, from string, to string, columns []string, outFile string) error {
+	if !isConvertFormat(from) || !isConvertFormat(to) {
+		return fmt.Errorf("unknown format, supported formats: %s", strings.Join(convertFormats, ", "))
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+
+	var size int64
+	var bar *pb.ProgressBar
+	var r io.Reader
+	if outFile == "" {
+		r, size = utils.OpenFileForReading(file)
+	} else {
+		r, size, bar = utils.OpenFileForReadingWithProgress(file)
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"path":       file,
+		"size_bytes": size,
+		"from":       from,
+		"to":         to,
+	}).Info("Converting file")
+
+	var out io.Writer = os.Stdout
+	if outFile != "" {
+		f, err := os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close() // Close the file when we're done
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	var cw *csv.Writer
+	if to == ConvertFormatCsv || to == ConvertFormatTsv {
+		cw = csv.NewWriter(w)
+		if to == ConvertFormatTsv {
+			cw.Comma = '\t'
+		}
+		defer cw.Flush()
+
+		if columns != nil {
+			cw.Write(columns)
+		}
+	}
+
+	err := readConvertRecords(r, from, func(rec *convertRecord) {
+		switch to {
+		case ConvertFormatJson:
+			w.Write(recordToJson(rec))
+			w.WriteByte('\n')
+		case ConvertFormatLogfmt:
+			w.Write(recordToLogfmt(rec))
+			w.WriteByte('\n')
+		case ConvertFormatLogdy:
+			w.Write(recordToLogdy(rec))
+			w.WriteByte('\n')
+		default:
+			if columns == nil {
+				columns = rec.keys
+				cw.Write(columns)
+			}
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				row[i] = recordValueString(rec.values[column])
+			}
+			cw.Write(row)
+		}
+	})
+
+	if bar != nil {
+		bar.Finish()
+	}
+
+	return err
+}
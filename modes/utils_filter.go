@@ -0,0 +1,170 @@
+package modes
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fastjson"
+)
+
+const FilterFormatRaw = "raw"
+const FilterFormatJson = "json"
+const FilterFormatCsv = "csv"
+
+// special columns, a raw line and a time extracted from a line
+const FilterColumnLine = "@line"
+const FilterColumnTime = "@time"
+
+// UtilsFilter writes lines of the files matching the query (see utils.Query) as raw lines,
+// JSON lines or CSV with selected columns. Columns are JSON fields (nested fields separated with a dot)
+// or one of the special columns: `@line` and `@time`.
+func UtilsFilter(files []string, query string, format string, columns []string, outFile string) {
+	q, err := utils.ParseQuery(query, time.Now())
+	if err != nil {
+		panic("Error while parsing query: " + err.Error())
+	}
+
+	switch format {
+	case FilterFormatRaw, FilterFormatJson:
+	case FilterFormatCsv:
+		if len(columns) == 0 {
+			panic("`columns` are required for the csv format")
+		}
+	default:
+		panic("Unknown output format: " + format)
+	}
+
+	var out io.Writer = os.Stdout
+	if outFile != "" {
+		f, err := os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close() // Close the file when we're done
+		out = f
+	}
+
+	var csvWriter *csv.Writer
+	if format == FilterFormatCsv {
+		csvWriter = csv.NewWriter(out)
+		csvWriter.Write(columns)
+		defer csvWriter.Flush()
+	}
+
+	for _, file := range files {
+		_, err := os.Stat(file)
+		if err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"path":  file,
+				"error": err.Error(),
+			}).Error("Reading file failed")
+			continue
+		}
+
+		var size int64
+		var bar *pb.ProgressBar
+		var r io.Reader
+		if outFile == "" {
+			r, size = utils.OpenFileForReading(file)
+		} else {
+			r, size, bar = utils.OpenFileForReadingWithProgress(file)
+		}
+
+		utils.Logger.WithFields(logrus.Fields{
+			"path":       file,
+			"size_bytes": size,
+		}).Info("Reading file")
+
+		utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+			// blank lines (e.g. the last one of a file) carry nothing to filter
+			if len(bytes.TrimSpace(line.Line)) == 0 {
+				return
+			}
+
+			l := utils.NewQueryLine(line.Line)
+			if !q.MatchLine(l) {
+				return
+			}
+
+			switch format {
+			case FilterFormatRaw:
+				out.Write(line.Line)
+				out.Write([]byte{'\n'})
+			case FilterFormatJson:
+				out.Write(filterJsonLine(l, columns))
+				out.Write([]byte{'\n'})
+			case FilterFormatCsv:
+				csvWriter.Write(filterCsvRecord(l, columns))
+			}
+		})
+
+		if bar != nil {
+			bar.Finish()
+		}
+	}
+}
+
+// filterJsonLine returns a JSON line as is or an object with selected columns,
+// a text line is wrapped in an object
+func filterJsonLine(l *utils.QueryLine, columns []string) []byte {
+	v := l.Json()
+	if len(columns) == 0 {
+		if v != nil {
+			return v.MarshalTo(nil)
+		}
+		bts, _ := json.Marshal(map[string]string{"line": string(l.Raw)})
+		return bts
+	}
+
+	arena := fastjson.Arena{}
+	obj := arena.NewObject()
+	for _, column := range columns {
+		switch column {
+		case FilterColumnLine:
+			obj.Set(column, arena.NewStringBytes(l.Raw))
+		case FilterColumnTime:
+			if ts, ok := l.Time(); ok {
+				obj.Set(column, arena.NewString(ts.Format(time.RFC3339Nano)))
+			} else {
+				obj.Set(column, arena.NewNull())
+			}
+		default:
+			var fv *fastjson.Value
+			if v != nil {
+				fv = v.Get(strings.Split(column, ".")...)
+			}
+			if fv == nil {
+				fv = arena.NewNull()
+			}
+			obj.Set(column, fv)
+		}
+	}
+
+	return obj.MarshalTo(nil)
+}
+
+func filterCsvRecord(l *utils.QueryLine, columns []string) []string {
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case FilterColumnLine:
+			record[i] = string(l.Raw)
+		case FilterColumnTime:
+			if ts, ok := l.Time(); ok {
+				record[i] = ts.Format(time.RFC3339Nano)
+			}
+		default:
+			record[i], _ = l.Field(column)
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,137 @@
+package modes
+
+import (
+	"container/heap"
+	"io"
+	"os"
+	"time"
+
+	"github.com/logdyhq/logdy-core/models"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// number of lines read ahead from each of the merged files
+const MERGE_READ_AHEAD = 1000
+
+// MergedLine is a line of one of the merged files, lines without a time
+// (e.g. stack traces) inherit the time of the previous line from the same file
+type MergedLine struct {
+	File string
+	Line string
+	Ts   time.Time
+}
+
+type mergeSource struct {
+	idx     int
+	lines   chan MergedLine
+	current MergedLine
+}
+
+// mergeHeap orders sources by a time of their current line, ties are resolved
+// by an order of the files so the output is deterministic
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].current.Ts.Equal(h[j].current.Ts) {
+		return h[i].current.Ts.Before(h[j].current.Ts)
+	}
+	return h[i].idx < h[j].idx
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+func readMergeSource(file string, r io.Reader, lines chan MergedLine) {
+	defer close(lines)
+
+	var last time.Time
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		if ts, ok := utils.ParseLineTime(line.Line); ok {
+			last = ts
+		}
+		lines <- MergedLine{File: file, Line: string(line.Line), Ts: last}
+	})
+}
+
+// MergeFiles interleaves lines of the files (plain or compressed) by their time, the files
+// are read in a streaming manner so only a few lines of each of them are kept in memory.
+// Each of the files is expected to be sorted by time.
+func MergeFiles(files []string, fn func(line MergedLine)) {
+	h := mergeHeap{}
+
+	for i, file := range files {
+		_, err := os.Stat(file)
+		if err != nil {
+			utils.Logger.WithFields(logrus.Fields{
+				"path":  file,
+				"error": err.Error(),
+			}).Error("Reading file failed")
+			continue
+		}
+
+		r, size := utils.OpenFileForReading(file)
+		utils.Logger.WithFields(logrus.Fields{
+			"path":       file,
+			"size_bytes": size,
+		}).Info("Reading file")
+
+		src := &mergeSource{idx: i, lines: make(chan MergedLine, MERGE_READ_AHEAD)}
+		go readMergeSource(file, r, src.lines)
+
+		if line, ok := <-src.lines; ok {
+			src.current = line
+			h = append(h, src)
+		}
+	}
+
+	heap.Init(&h)
+	for h.Len() > 0 {
+		src := h[0]
+		fn(src.current)
+
+		if line, ok := <-src.lines; ok {
+			src.current = line
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+}
+
+// UtilsMerge writes lines of the files interleaved by time into a file or standard output,
+// each line is prefixed with a file it comes from
+func UtilsMerge(files []string, outFile string) {
+	var out io.Writer = os.Stdout
+	if outFile != "" {
+		f, err := os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close() // Close the file when we're done
+		out = f
+	}
+
+	MergeFiles(files, func(line MergedLine) {
+		out.Write([]byte("[" + line.File + "] " + line.Line + "\n"))
+	})
+}
+
+// UtilsMergeServe produces lines of the files interleaved by time as messages with a time
+// extracted from a line, the file is set as an origin of a message
+func UtilsMergeServe(ch chan models.Message, files []string) {
+	MergeFiles(files, func(line MergedLine) {
+		ts := line.Ts
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		ProduceMessageStringTimestamped(ch, line.Line, models.MessageTypeStdout, &models.MessageOrigin{File: line.File}, ts)
+	})
+}
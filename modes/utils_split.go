@@ -0,0 +1,239 @@
+package modes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// max number of output files kept open at once when splitting by a field value,
+// above that all of them are closed and reopened for appending when needed
+const SPLIT_MAX_OPEN_FILES = 128
+
+// a value used in a name of a file for lines without a time or a field
+const splitNoValue = "none"
+
+// SplitConfig describes how a file is split, exactly one of Lines, Bytes, TimeBucket or Field has to be set.
+// Names of the output files are created from the Template, with placeholders:
+// {base} - a path of the input file without extensions, {ext} - an extension (e.g. `.log`),
+// {n} - a sequence number, {bucket} - a start of a time bucket in UTC, {value} - a value of the field
+type SplitConfig struct {
+	Lines      int
+	Bytes      int64
+	TimeBucket time.Duration
+	Field      string
+	Template   string
+}
+
+var splitValueRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (c SplitConfig) validate() error {
+	modes := 0
+	for _, set := range []bool{c.Lines > 0, c.Bytes > 0, c.TimeBucket > 0, c.Field != ""} {
+		if set {
+			modes++
+		}
+	}
+
+	if modes != 1 {
+		return errors.New("exactly one of: lines, bytes, time bucket or field has to be set")
+	}
+
+	return nil
+}
+
+func (c SplitConfig) template() string {
+	if c.Template != "" {
+		return c.Template
+	}
+
+	switch {
+	case c.TimeBucket > 0:
+		return "{base}.{bucket}{ext}"
+	case c.Field != "":
+		return "{base}.{value}{ext}"
+	}
+	return "{base}.{n}{ext}"
+}
+
+// splitBaseAndExt returns a path without extensions and the extension of the content,
+// a compression extension is dropped since output files are not compressed, e.g. app.log.gz -> app, .log
+func splitBaseAndExt(file string) (string, string) {
+	for _, ext := range []string{".gz", ".zst", ".bz2"} {
+		if strings.HasSuffix(file, ext) {
+			file = strings.TrimSuffix(file, ext)
+			break
+		}
+	}
+
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext), ext
+}
+
+type splitOutputs struct {
+	open    map[string]*bufio.Writer
+	files   map[string]*os.File
+	created map[string]bool
+	counts  map[string]int
+}
+
+func newSplitOutputs() *splitOutputs {
+	return &splitOutputs{
+		open:    map[string]*bufio.Writer{},
+		files:   map[string]*os.File{},
+		created: map[string]bool{},
+		counts:  map[string]int{},
+	}
+}
+
+// write appends a line to a file, the file is truncated when written for the first time
+func (o *splitOutputs) write(name string, line []byte) {
+	w, ok := o.open[name]
+	if !ok {
+		if len(o.open) >= SPLIT_MAX_OPEN_FILES {
+			o.closeAll()
+		}
+
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if !o.created[name] {
+			flags |= os.O_TRUNC
+		}
+		f, err := os.OpenFile(name, flags, 0644)
+		if err != nil {
+			panic(err)
+		}
+
+		o.created[name] = true
+		o.files[name] = f
+		w = bufio.NewWriter(f)
+		o.open[name] = w
+	}
+
+	w.Write(line)
+	w.WriteByte('\n')
+	o.counts[name]++
+}
+
+func (o *splitOutputs) close(name string) {
+	if w, ok := o.open[name]; ok {
+		w.Flush()
+		o.files[name].Close()
+		delete(o.open, name)
+		delete(o.files, name)
+	}
+}
+
+func (o *splitOutputs) closeAll() {
+	for name := range o.open {
+		o.close(name)
+	}
+}
+
+// UtilsSplit splits a file (plain or compressed) into multiple files every N lines or bytes,
+// per time bucket or per distinct value of a JSON field. It returns a number of lines written to each file.
+func UtilsSplit(file string, config SplitConfig) (map[string]int, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+
+	var extractor *utils.TimeExtractor
+	if config.TimeBucket > 0 {
+		extractor = detectFileTimeExtractor(file)
+	}
+
+	r, size, bar := utils.OpenFileForReadingWithProgress(file)
+	utils.Logger.WithFields(logrus.Fields{
+		"path":       file,
+		"size_bytes": size,
+	}).Info("Reading file")
+
+	base, ext := splitBaseAndExt(file)
+	template := config.template()
+	name := func(n int, bucket string, value string) string {
+		return strings.NewReplacer(
+			"{base}", base,
+			"{ext}", ext,
+			"{n}", strconv.Itoa(n),
+			"{bucket}", bucket,
+			"{value}", value,
+		).Replace(template)
+	}
+
+	outputs := newSplitOutputs()
+	n := 1
+	chunkLines := 0
+	var chunkBytes int64
+	bucket := splitNoValue
+
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		var out string
+
+		switch {
+		case config.Lines > 0:
+			if chunkLines >= config.Lines {
+				outputs.close(name(n, "", ""))
+				n++
+				chunkLines = 0
+			}
+			chunkLines++
+			out = name(n, "", "")
+		case config.Bytes > 0:
+			lineBytes := int64(len(line.Line)) + 1
+			// lines are never split, a chunk is bigger than the limit only when a single line is
+			if chunkBytes > 0 && chunkBytes+lineBytes > config.Bytes {
+				outputs.close(name(n, "", ""))
+				n++
+				chunkBytes = 0
+			}
+			chunkBytes += lineBytes
+			out = name(n, "", "")
+		case config.TimeBucket > 0:
+			// lines without a time belong to the bucket of a previous line
+			// buckets are truncated and named in UTC, the same time in any zone lands in the same file
+			if ts, ok := extractor.Extract(line.Line); ok {
+				bucket = ts.UTC().Truncate(config.TimeBucket).Format("20060102T150405")
+			}
+			out = name(0, bucket, "")
+		default:
+			value := splitNoValue
+			if v, ok := utils.NewQueryLine(line.Line).Field(config.Field); ok && v != "" {
+				value = splitValueRegex.ReplaceAllString(v, "_")
+			}
+			out = name(0, "", value)
+		}
+
+		outputs.write(out, line.Line)
+	})
+
+	outputs.closeAll()
+	bar.Finish()
+
+	return outputs.counts, nil
+}
+
+// WriteSplitSummary writes names of created files with a number of lines in each of them
+func WriteSplitSummary(counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stdout, "%s\t%d lines\n", name, counts[name])
+	}
+}
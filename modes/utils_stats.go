@@ -0,0 +1,302 @@
+package modes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/logdyhq/logdy-core/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fastjson"
+)
+
+// number of the most frequent JSON keys included in stats
+const STATS_TOP_KEYS = 20
+
+// distinct values of a key are counted up to this limit to keep memory bounded
+const STATS_MAX_CARDINALITY = 10_000
+
+// max number of rows of the lines per minute histogram in text output,
+// minutes are grouped into bigger buckets above that
+const STATS_HISTOGRAM_ROWS = 60
+
+type FileStats struct {
+	Path           string         `json:"path"`
+	SizeBytes      int64          `json:"size_bytes"` // size on disk, compressed files are smaller than `bytes`
+	Bytes          int64          `json:"bytes"`
+	Lines          int            `json:"lines"`
+	JsonLines      int            `json:"json_lines"`
+	RawLines       int            `json:"raw_lines"`
+	TimedLines     int            `json:"timed_lines"`
+	From           *time.Time     `json:"from"`
+	To             *time.Time     `json:"to"`
+	LinesPerMinute []MinuteCount  `json:"lines_per_minute"`
+	Levels         map[string]int `json:"levels"`
+	Keys           []KeyStats     `json:"keys"`
+}
+
+type MinuteCount struct {
+	Minute time.Time `json:"minute"`
+	Count  int       `json:"count"`
+}
+
+type KeyStats struct {
+	Key         string `json:"key"`
+	Count       int    `json:"count"`
+	Cardinality int    `json:"cardinality"`
+	// whether there are more distinct values than counted
+	CardinalityCapped bool `json:"cardinality_capped"`
+}
+
+type statsCollector struct {
+	stats   FileStats
+	minutes map[int64]int
+	keys    map[string]int
+	values  map[string]map[string]struct{}
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		stats:   FileStats{Levels: map[string]int{}},
+		minutes: map[int64]int{},
+		keys:    map[string]int{},
+		values:  map[string]map[string]struct{}{},
+	}
+}
+
+func (c *statsCollector) add(raw []byte) {
+	s := &c.stats
+	s.Lines++
+	s.Bytes += int64(len(raw)) + 1
+
+	l := utils.NewQueryLine(raw)
+	if v := l.Json(); v != nil {
+		s.JsonLines++
+		c.addKeys("", v)
+	} else {
+		s.RawLines++
+	}
+
+	if level, ok := utils.LineLevel(l); ok {
+		s.Levels[level]++
+	}
+
+	ts, ok := l.Time()
+	if !ok {
+		return
+	}
+
+	s.TimedLines++
+	if s.From == nil || ts.Before(*s.From) {
+		s.From = &ts
+	}
+	if s.To == nil || ts.After(*s.To) {
+		s.To = &ts
+	}
+	c.minutes[ts.Truncate(time.Minute).Unix()]++
+}
+
+// addKeys counts keys of an object, nested objects are flattened with a dot
+func (c *statsCollector) addKeys(prefix string, v *fastjson.Value) {
+	obj, err := v.Object()
+	if err != nil {
+		return
+	}
+
+	obj.Visit(func(k []byte, fv *fastjson.Value) {
+		key := prefix + string(k)
+		if fv.Type() == fastjson.TypeObject {
+			c.addKeys(key+".", fv)
+			return
+		}
+
+		c.keys[key]++
+		values, ok := c.values[key]
+		if !ok {
+			values = map[string]struct{}{}
+			c.values[key] = values
+		}
+		if len(values) <= STATS_MAX_CARDINALITY {
+			values[utils.JsonValueString(fv)] = struct{}{}
+		}
+	})
+}
+
+func (c *statsCollector) result() FileStats {
+	s := c.stats
+
+	s.LinesPerMinute = make([]MinuteCount, 0, len(c.minutes))
+	for minute, count := range c.minutes {
+		s.LinesPerMinute = append(s.LinesPerMinute, MinuteCount{Minute: time.Unix(minute, 0), Count: count})
+	}
+	sort.Slice(s.LinesPerMinute, func(i, j int) bool {
+		return s.LinesPerMinute[i].Minute.Before(s.LinesPerMinute[j].Minute)
+	})
+
+	s.Keys = make([]KeyStats, 0, len(c.keys))
+	for key, count := range c.keys {
+		cardinality := len(c.values[key])
+		s.Keys = append(s.Keys, KeyStats{
+			Key:               key,
+			Count:             count,
+			Cardinality:       min(cardinality, STATS_MAX_CARDINALITY),
+			CardinalityCapped: cardinality > STATS_MAX_CARDINALITY,
+		})
+	}
+	sort.Slice(s.Keys, func(i, j int) bool {
+		if s.Keys[i].Count != s.Keys[j].Count {
+			return s.Keys[i].Count > s.Keys[j].Count
+		}
+		return s.Keys[i].Key < s.Keys[j].Key
+	})
+	if len(s.Keys) > STATS_TOP_KEYS {
+		s.Keys = s.Keys[:STATS_TOP_KEYS]
+	}
+
+	return s
+}
+
+// CollectFileStats reads a file (plain or compressed) and summarizes its lines
+func CollectFileStats(file string, showProgress bool) (FileStats, error) {
+	if _, err := os.Stat(file); err != nil {
+		return FileStats{}, err
+	}
+
+	var size int64
+	var bar *pb.ProgressBar
+	var r io.Reader
+	if showProgress {
+		r, size, bar = utils.OpenFileForReadingWithProgress(file)
+	} else {
+		r, size = utils.OpenFileForReading(file)
+	}
+
+	c := newStatsCollector()
+	utils.LineCounterWithChannel(r, func(line utils.Line, cancel func()) {
+		c.add(line.Line)
+	})
+
+	if bar != nil {
+		bar.Finish()
+	}
+
+	stats := c.result()
+	stats.Path = file
+	stats.SizeBytes = size
+
+	return stats, nil
+}
+
+// UtilsStats prints a summary of a file as a human readable text or JSON
+func UtilsStats(file string, asJson bool) {
+	stats, err := CollectFileStats(file, true)
+	if err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"path":  file,
+			"error": err.Error(),
+		}).Error("Reading file failed")
+		return
+	}
+
+	if asJson {
+		bts, _ := json.MarshalIndent(stats, "", "  ")
+		os.Stdout.Write(bts)
+		os.Stdout.Write([]byte{'\n'})
+		return
+	}
+
+	WriteFileStatsText(os.Stdout, stats)
+}
+
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// WriteFileStatsText writes stats in a human readable form
+func WriteFileStatsText(w io.Writer, s FileStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "File:\t%s\n", s.Path)
+	fmt.Fprintf(tw, "Size:\t%s on disk, %s of lines\n", utils.FormatSize(s.SizeBytes), utils.FormatSize(s.Bytes))
+	fmt.Fprintf(tw, "Lines:\t%d (JSON %d, %.1f%%; raw %d, %.1f%%)\n", s.Lines,
+		s.JsonLines, percent(s.JsonLines, s.Lines), s.RawLines, percent(s.RawLines, s.Lines))
+
+	if s.From != nil {
+		fmt.Fprintf(tw, "Time range:\t%s - %s (%s), %d lines with a time\n",
+			s.From.Format(time.RFC3339), s.To.Format(time.RFC3339), s.To.Sub(*s.From), s.TimedLines)
+	} else {
+		fmt.Fprintf(tw, "Time range:\tno lines with a time\n")
+	}
+	tw.Flush()
+
+	if len(s.Levels) > 0 {
+		levels := make([]string, 0, len(s.Levels))
+		for level := range s.Levels {
+			levels = append(levels, level)
+		}
+		sort.Slice(levels, func(i, j int) bool {
+			if s.Levels[levels[i]] != s.Levels[levels[j]] {
+				return s.Levels[levels[i]] > s.Levels[levels[j]]
+			}
+			return levels[i] < levels[j]
+		})
+
+		fmt.Fprintf(w, "\nLevels:\n")
+		for _, level := range levels {
+			fmt.Fprintf(tw, "  %s\t%d\t%.1f%%\n", level, s.Levels[level], percent(s.Levels[level], s.Lines))
+		}
+		tw.Flush()
+	}
+
+	if len(s.Keys) > 0 {
+		fmt.Fprintf(w, "\nTop JSON keys:\n")
+		fmt.Fprintf(tw, "  KEY\tCOUNT\tDISTINCT VALUES\n")
+		for _, k := range s.Keys {
+			cardinality := fmt.Sprint(k.Cardinality)
+			if k.CardinalityCapped {
+				cardinality += "+"
+			}
+			fmt.Fprintf(tw, "  %s\t%d\t%s\n", k.Key, k.Count, cardinality)
+		}
+		tw.Flush()
+	}
+
+	if len(s.LinesPerMinute) > 0 {
+		writeHistogram(w, s.LinesPerMinute)
+	}
+}
+
+// writeHistogram writes lines per minute as bars, minutes are grouped into
+// bigger buckets so the histogram fits into STATS_HISTOGRAM_ROWS rows
+func writeHistogram(w io.Writer, minutes []MinuteCount) {
+	first := minutes[0].Minute
+	last := minutes[len(minutes)-1].Minute
+	bucket := time.Minute
+	for last.Sub(first)/bucket >= STATS_HISTOGRAM_ROWS {
+		bucket *= 2
+	}
+
+	counts := map[int64]int{}
+	maxCount := 0
+	for _, m := range minutes {
+		b := first.Add(m.Minute.Sub(first) / bucket * bucket).Unix()
+		counts[b] += m.Count
+		maxCount = max(maxCount, counts[b])
+	}
+
+	fmt.Fprintf(w, "\nLines per %s:\n", strings.TrimSuffix(bucket.String(), "0s"))
+	for t := first; !t.After(last); t = t.Add(bucket) {
+		count := counts[t.Unix()]
+		bar := strings.Repeat("#", count*40/maxCount)
+		fmt.Fprintf(w, "  %s  %-40s %d\n", t.Format("2006-01-02 15:04"), bar, count)
+	}
+}
@@ -1,12 +1,16 @@
 package modes
 
 import (
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/logdyhq/logdy-core/models"
 	"github.com/logdyhq/logdy-core/utils"
 	"github.com/stretchr/testify/assert" // Replace with your favorite testing framework
 )
@@ -495,3 +499,388 @@ func TestUtilsCutLineNumberLong(t *testing.T) {
 		})
 	}
 }
+
+func captureStdout(t *testing.T, fn func()) string {
+	var oldWriter = os.Stdout
+	stdout, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = stdout
+	defer func() {
+		os.Stdout = oldWriter
+	}()
+
+	fn()
+
+	content, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestUtilsCutByDateSeek(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sorted := strings.Builder{}
+	unsorted := strings.Builder{}
+	for i := 0; i < 20_000; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		sorted.WriteString("[" + ts.Format("2006-01-02 15:04:05") + "] line " + strconv.Itoa(i) + "\n")
+		if i%100 == 0 {
+			sorted.WriteString("x\n") // short line without a date
+		}
+
+		if i%7 == 0 {
+			ts = ts.Add(-time.Hour)
+		}
+		unsorted.WriteString("[" + ts.Format("2006-01-02 15:04:05") + "] line " + strconv.Itoa(i) + "\n")
+	}
+
+	sortedFile := t.TempDir() + "/sorted.log"
+	assert.Nil(t, os.WriteFile(sortedFile, []byte(sorted.String()), 0644))
+	unsortedFile := t.TempDir() + "/unsorted.log"
+	assert.Nil(t, os.WriteFile(unsortedFile, []byte(unsorted.String()), 0644))
+
+	const format = "2006-01-02 15:04:05"
+	from := start.Add(15_000 * time.Second).Format(format)
+	to := start.Add(15_002 * time.Second).Format(format)
+
+	assert.Equal(t, 0, int(seekToDate(unsortedFile, int64(unsorted.Len()), start.Add(15_000*time.Second), utils.LayoutTimeExtractor(format, 1))))
+
+	output := captureStdout(t, func() {
+		UtilsCutByDate(sortedFile, from, to, format, 1, "")
+	})
+	assert.Equal(t, "[2024-05-01 04:10:00] line 15000\nx\n[2024-05-01 04:10:01] line 15001\n[2024-05-01 04:10:02] line 15002\n", output)
+
+	output = captureStdout(t, func() {
+		UtilsCutByDate(unsortedFile, from, to, format, 1, "")
+	})
+	// line 15001 is moved back by an hour
+	assert.Equal(t, "[2024-05-01 04:10:00] line 15000\n[2024-05-01 03:10:01] line 15001\n[2024-05-01 04:10:02] line 15002\n", output)
+}
+
+func TestUtilsCutByDateAuto(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	content := strings.Builder{}
+	nested := strings.Builder{}
+	for i := 0; i < 100; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		content.WriteString(`{"msg":"line ` + strconv.Itoa(i) + `","ts":` + strconv.FormatInt(ts.UnixMilli(), 10) + "}\n")
+		nested.WriteString(`{"msg":"line ` + strconv.Itoa(i) + `","meta":{"at":"` + ts.Format(time.RFC3339) + `"}}` + "\n")
+	}
+
+	file := t.TempDir() + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(content.String()), 0644))
+	nestedFile := t.TempDir() + "/nested.log"
+	assert.Nil(t, os.WriteFile(nestedFile, []byte(nested.String()), 0644))
+
+	output := captureStdout(t, func() {
+		UtilsCutByDateAuto(file, "2024-05-01T00:50:00Z", "2024-05-01T00:51:00Z", "", "")
+	})
+	assert.Equal(t, `{"msg":"line 50","ts":1714524600000}`+"\n"+`{"msg":"line 51","ts":1714524660000}`+"\n", output)
+
+	output = captureStdout(t, func() {
+		UtilsCutByDateAuto(nestedFile, "1714524600", "1714524600", "meta.at", "")
+	})
+	assert.Equal(t, `{"msg":"line 50","meta":{"at":"2024-05-01T00:50:00Z"}}`+"\n", output)
+}
+
+func TestUtilsFilter(t *testing.T) {
+	dir := t.TempDir()
+	file1 := dir + "/app1.log"
+	file2 := dir + "/app2.log"
+	assert.Nil(t, os.WriteFile(file1, []byte(`{"level":"info","status":200,"msg":"ok"}
+{"level":"error","status":500,"msg":"failed, retrying"}
+plain text line
+`), 0644))
+	assert.Nil(t, os.WriteFile(file2, []byte(`{"level":"error","status":503,"msg":"unavailable"}
+`), 0644))
+
+	output := captureStdout(t, func() {
+		UtilsFilter([]string{file1, file2}, "level:error status>=500", FilterFormatRaw, nil, "")
+	})
+	assert.Equal(t, `{"level":"error","status":500,"msg":"failed, retrying"}
+{"level":"error","status":503,"msg":"unavailable"}
+`, output)
+
+	output = captureStdout(t, func() {
+		UtilsFilter([]string{file1}, "text", FilterFormatJson, nil, "")
+	})
+	assert.Equal(t, `{"line":"plain text line"}`+"\n", output)
+
+	output = captureStdout(t, func() {
+		UtilsFilter([]string{file1}, "status>=200", FilterFormatJson, []string{"status", "missing"}, "")
+	})
+	assert.Equal(t, `{"status":200,"missing":null}`+"\n"+`{"status":500,"missing":null}`+"\n", output)
+
+	// text and blank lines don't have the field
+	output = captureStdout(t, func() {
+		UtilsFilter([]string{file1}, "status!=200", FilterFormatRaw, nil, "")
+	})
+	assert.Equal(t, `{"level":"error","status":500,"msg":"failed, retrying"}`+"\n", output)
+
+	output = captureStdout(t, func() {
+		UtilsFilter([]string{file2}, "", FilterFormatRaw, nil, "")
+	})
+	assert.Equal(t, `{"level":"error","status":503,"msg":"unavailable"}`+"\n", output)
+
+	outFile := dir + "/out.csv"
+	captureStdout(t, func() {
+		UtilsFilter([]string{file1, file2}, "level:error", FilterFormatCsv, []string{"status", "msg"}, outFile)
+	})
+	content, err := os.ReadFile(outFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "status,msg\n500,\"failed, retrying\"\n503,unavailable\n", string(content))
+}
+
+func TestCollectFileStats(t *testing.T) {
+	file := t.TempDir() + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(`{"ts":"2024-05-01T10:00:10Z","level":"info","msg":"a","req":{"id":1}}
+{"ts":"2024-05-01T10:00:50Z","level":"info","msg":"b","req":{"id":2}}
+{"ts":"2024-05-01T10:02:00Z","level":"error","msg":"a"}
+2024-05-01T10:02:30Z WARN plain line
+no time here
+`), 0644))
+
+	stats, err := CollectFileStats(file, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, stats.Lines)
+	assert.Equal(t, 3, stats.JsonLines)
+	assert.Equal(t, 2, stats.RawLines)
+	assert.Equal(t, 4, stats.TimedLines)
+	assert.True(t, time.Date(2024, 5, 1, 10, 0, 10, 0, time.UTC).Equal(*stats.From))
+	assert.True(t, time.Date(2024, 5, 1, 10, 2, 30, 0, time.UTC).Equal(*stats.To))
+	assert.Equal(t, map[string]int{"info": 2, "error": 1, "warn": 1}, stats.Levels)
+
+	assert.Equal(t, 2, len(stats.LinesPerMinute))
+	assert.Equal(t, 2, stats.LinesPerMinute[0].Count)
+	assert.Equal(t, 2, stats.LinesPerMinute[1].Count)
+
+	assert.Equal(t, []KeyStats{
+		{Key: "level", Count: 3, Cardinality: 2},
+		{Key: "msg", Count: 3, Cardinality: 2},
+		{Key: "ts", Count: 3, Cardinality: 3},
+		{Key: "req.id", Count: 2, Cardinality: 2},
+	}, stats.Keys)
+
+	out := strings.Builder{}
+	WriteFileStatsText(&out, stats)
+	assert.Contains(t, out.String(), "Lines:       5 (JSON 3, 60.0%; raw 2, 40.0%)")
+	assert.Contains(t, out.String(), "Lines per 1m:")
+}
+
+func TestUtilsMerge(t *testing.T) {
+	dir := t.TempDir()
+	a := dir + "/a.log"
+	b := dir + "/b.log"
+	assert.Nil(t, os.WriteFile(a, []byte(`2024-05-01T10:00:00Z a1
+2024-05-01T10:00:02Z a2
+  at stack trace line
+2024-05-01T10:00:04Z a3
+`), 0644))
+	assert.Nil(t, os.WriteFile(b, []byte(`{"ts":"2024-05-01T10:00:01Z","msg":"b1"}
+{"ts":"2024-05-01T10:00:02Z","msg":"b2"}
+{"ts":"2024-05-01T10:00:05Z","msg":"b3"}
+`), 0644))
+
+	output := captureStdout(t, func() {
+		UtilsMerge([]string{a, b}, "")
+	})
+	assert.Equal(t, strings.Join([]string{
+		"[" + a + "] 2024-05-01T10:00:00Z a1",
+		"[" + b + `] {"ts":"2024-05-01T10:00:01Z","msg":"b1"}`,
+		"[" + a + "] 2024-05-01T10:00:02Z a2",
+		"[" + a + "]   at stack trace line",
+		"[" + b + `] {"ts":"2024-05-01T10:00:02Z","msg":"b2"}`,
+		"[" + a + "] 2024-05-01T10:00:04Z a3",
+		"[" + b + `] {"ts":"2024-05-01T10:00:05Z","msg":"b3"}`,
+	}, "\n")+"\n", output)
+
+	ch := make(chan models.Message, 10)
+	UtilsMergeServe(ch, []string{a, b})
+	assert.Equal(t, 7, len(ch))
+
+	msg := <-ch
+	assert.Equal(t, a, msg.Origin.File)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).UnixMilli(), msg.Ts)
+	msg = <-ch
+	assert.Equal(t, b, msg.Origin.File)
+	assert.True(t, msg.IsJson)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC).UnixMilli(), msg.Ts)
+}
+
+func TestUtilsSplit(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(`{"ts":"2024-05-01T10:59:00Z","svc":"api","msg":"1"}
+{"ts":"2024-05-01T11:00:00Z","svc":"db","msg":"2"}
+stack trace without a time
+{"ts":"2024-05-01T11:30:00Z","svc":"api/v2","msg":"4"}
+{"ts":"2024-05-01T12:00:00Z","msg":"5"}
+`), 0644))
+
+	read := func(name string) string {
+		bts, err := os.ReadFile(name)
+		assert.Nil(t, err)
+		return string(bts)
+	}
+
+	_, err := UtilsSplit(file, SplitConfig{Lines: 2, Field: "svc"})
+	assert.NotNil(t, err)
+
+	counts, err := UtilsSplit(file, SplitConfig{Lines: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{dir + "/app.1.log": 2, dir + "/app.2.log": 2, dir + "/app.3.log": 1}, counts)
+	assert.Equal(t, "stack trace without a time\n"+`{"ts":"2024-05-01T11:30:00Z","svc":"api/v2","msg":"4"}`+"\n", read(dir+"/app.2.log"))
+
+	counts, err = UtilsSplit(file, SplitConfig{Bytes: 110, Template: dir + "/chunk-{n}.txt"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{dir + "/chunk-1.txt": 2, dir + "/chunk-2.txt": 2, dir + "/chunk-3.txt": 1}, counts)
+
+	counts, err = UtilsSplit(file, SplitConfig{TimeBucket: time.Hour})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{
+		dir + "/app.20240501T100000.log": 1,
+		dir + "/app.20240501T110000.log": 3,
+		dir + "/app.20240501T120000.log": 1,
+	}, counts)
+
+	counts, err = UtilsSplit(file, SplitConfig{Field: "svc"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{
+		dir + "/app.api.log":    1,
+		dir + "/app.db.log":     1,
+		dir + "/app.api_v2.log": 1,
+		dir + "/app.none.log":   2,
+	}, counts)
+}
+
+func TestUtilsSplitTimeBucketTimeZone(t *testing.T) {
+	// a zone with a half hour offset makes buckets truncated and named in different zones differ
+	t.Setenv("TZ", "Asia/Kolkata")
+	local := time.Local
+	time.Local = time.FixedZone("IST", 5*60*60+30*60)
+	t.Cleanup(func() { time.Local = local })
+
+	dir := t.TempDir()
+	file := dir + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(`{"ts":"2024-05-01T16:29:00+05:30","msg":"1"}
+{"ts":"2024-05-01T11:00:00Z","msg":"2"}
+{"ts":"2024-05-01 17:00:00","msg":"3"}
+`), 0644))
+
+	counts, err := UtilsSplit(file, SplitConfig{TimeBucket: time.Hour})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{
+		dir + "/app.20240501T100000.log": 1,
+		dir + "/app.20240501T110000.log": 2,
+	}, counts)
+}
+
+func TestUtilsConvert(t *testing.T) {
+	dir := t.TempDir()
+	convert := func(content string, from string, to string, columns []string) string {
+		file := dir + "/in.log"
+		assert.Nil(t, os.WriteFile(file, []byte(content), 0644))
+		return captureStdout(t, func() {
+			assert.Nil(t, UtilsConvert(file, from, to, columns, ""))
+		})
+	}
+
+	logfmt := `level=info msg="hello \"world\"" took=12 ok=true id=007 debug
+plain text line
+`
+	assert.Equal(t, `{"level":"info","msg":"hello \"world\"","took":12,"ok":true,"id":"007","debug":true}`+"\n"+
+		`{"line":"plain text line"}`+"\n", convert(logfmt, ConvertFormatLogfmt, ConvertFormatJson, nil))
+
+	jsonLines := `{"level":"info","msg":"hello world","req":{"id":1},"n":null}
+{"level":"error","msg":"","extra":"x"}
+`
+	assert.Equal(t, `level=info msg="hello world" req="{\"id\":1}" n=`+"\n"+`level=error msg="" extra=x`+"\n",
+		convert(jsonLines, ConvertFormatJson, ConvertFormatLogfmt, nil))
+	assert.Equal(t, "level,msg,req,n\ninfo,hello world,\"{\"\"id\"\":1}\",\nerror,,,\n",
+		convert(jsonLines, ConvertFormatJson, ConvertFormatCsv, nil))
+	assert.Equal(t, "msg\textra\nhello world\t\n\tx\n",
+		convert(jsonLines, ConvertFormatJson, ConvertFormatTsv, []string{"msg", "extra"}))
+
+	csvContent := "level,msg,status\ninfo,\"multi\nline\",200\n"
+	assert.Equal(t, `{"level":"info","msg":"multi\nline","status":200}`+"\n", convert(csvContent, ConvertFormatCsv, ConvertFormatJson, nil))
+
+	logdy := convert(`{"ts":"2024-05-01T10:00:00Z","msg":"a"}`+"\nplain\n", ConvertFormatJson, ConvertFormatLogdy, nil)
+	lines := strings.Split(strings.TrimSpace(logdy), "\n")
+	assert.Equal(t, 2, len(lines))
+	msg := models.Message{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &msg))
+	assert.True(t, msg.IsJson)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).UnixMilli(), msg.Ts)
+
+	assert.Equal(t, `{"ts":"2024-05-01T10:00:00Z","msg":"a"}`+"\n"+`{"line":"plain"}`+"\n", convert(logdy, ConvertFormatLogdy, ConvertFormatJson, nil))
+
+	file := dir + "/in.log"
+	assert.NotNil(t, UtilsConvert(file, "xml", ConvertFormatJson, nil, ""))
+}
+
+func TestUtilsCutWithLineIndex(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	content := strings.Builder{}
+	for i := 1; i <= 5000; i++ {
+		content.WriteString(start.Add(time.Duration(i)*time.Second).Format(time.RFC3339) + " line " + strconv.Itoa(i) + "\n")
+	}
+	file := t.TempDir() + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(content.String()), 0644))
+
+	withoutIndex := captureStdout(t, func() {
+		UtilsCutByLineNumber(file, 3, 4321, "")
+	})
+	assert.Equal(t, "2024-05-01T01:12:01Z line 4321\n2024-05-01T01:12:02Z line 4322\n2024-05-01T01:12:03Z line 4323\n", withoutIndex)
+
+	idx, err := UtilsIndex(file, 100, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5000), idx.Lines)
+
+	withIndex := captureStdout(t, func() {
+		UtilsCutByLineNumber(file, 3, 4321, "")
+	})
+	assert.Equal(t, withoutIndex, withIndex)
+
+	assert.Equal(t, idx.TimeOffset(start.Add(4321*time.Second)), seekToDate(file, int64(content.Len()), start.Add(4321*time.Second), utils.AnyTimeExtractor()))
+	output := captureStdout(t, func() {
+		UtilsCutByDateAuto(file, "2024-05-01T01:12:01Z", "2024-05-01T01:12:02Z", "", "")
+	})
+	assert.Equal(t, "2024-05-01T01:12:01Z line 4321\n2024-05-01T01:12:02Z line 4322\n", output)
+}
+
+func TestUtilsCutByStringWithOptions(t *testing.T) {
+	file := t.TempDir() + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(`boot
+conn 1
+BEGIN req 1
+GET /a
+END req 1
+idle
+BEGIN REQ 2
+GET /b
+END req 2
+BEGIN req 3
+GET /c`), 0644))
+
+	cut := func(start string, end string, opts CutByStringOptions) string {
+		return captureStdout(t, func() {
+			UtilsCutByStringWithOptions(file, start, end, "", opts)
+		})
+	}
+
+	assert.Equal(t, "BEGIN req 1\nGET /a\nEND req 1\n", cut("BEGIN req", "END req", CutByStringOptions{}))
+
+	assert.Equal(t, "BEGIN req 1\nGET /a\nEND req 1\n--\nBEGIN req 3\nGET /c\n",
+		cut("BEGIN req", "END req", CutByStringOptions{All: true, Separator: "--"}))
+
+	assert.Equal(t, "GET /a\nGET /b\nGET /c\n",
+		cut("begin req", "end req", CutByStringOptions{All: true, CaseInsensitive: true, ExcludeStart: true, ExcludeEnd: true}))
+
+	assert.Equal(t, "conn 1\nBEGIN req 1\nGET /a\nEND req 1\nidle\nBEGIN REQ 2\nGET /b\nEND req 2\nBEGIN req 3\nGET /c\n",
+		cut(`^BEGIN (?i:req) \d$`, `^END req \d$`, CutByStringOptions{All: true, Regex: true, Context: 1}))
+
+	assert.Equal(t, "GET /a\n", cut("^GET", "^GET", CutByStringOptions{Regex: true}))
+}
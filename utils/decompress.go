@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const CompressionNone Compression = ""
+const CompressionGzip Compression = "gzip"
+const CompressionZstd Compression = "zstd"
+const CompressionBzip2 Compression = "bzip2"
+
+var compressionMagic = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{compression: CompressionGzip, magic: []byte{0x1f, 0x8b}},
+	{compression: CompressionZstd, magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{compression: CompressionBzip2, magic: []byte{'B', 'Z', 'h'}},
+}
+
+// DetectCompression recognizes a compression format by the magic bytes
+// at the beginning of the data
+func DetectCompression(header []byte) Compression {
+	for _, cm := range compressionMagic {
+		if bytes.HasPrefix(header, cm.magic) {
+			return cm.compression
+		}
+	}
+
+	return CompressionNone
+}
+
+var compressedExtensions = []string{".gz", ".zst", ".bz2"}
+
+// IsCompressedFile reports whether a file is compressed with one of the supported formats,
+// the extension is checked as well since a file that is being written might not contain magic bytes yet
+func IsCompressedFile(file string) bool {
+	for _, ext := range compressedExtensions {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	n, _ := io.ReadFull(f, header)
+
+	return DetectCompression(header[:n]) != CompressionNone
+}
+
+// NewDecompressingReader returns a reader that transparently decompresses the data
+// if it's compressed with one of the supported formats, otherwise the data is passed as is
+func NewDecompressingReader(r io.Reader) (io.Reader, Compression, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(4)
+
+	compression := DetectCompression(header)
+	switch compression {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(br)
+		return gr, compression, err
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, compression, err
+		}
+		return zr.IOReadCloser(), compression, nil
+	case CompressionBzip2:
+		return bzip2.NewReader(br), compression, nil
+	}
+
+	return br, compression, nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const decompressTestContent = "line 1\nline 2\nline 3"
+
+func gzipContent(t *testing.T) []byte {
+	return gzipBytes(t, decompressTestContent)
+}
+
+func gzipBytes(t *testing.T, content string) []byte {
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdContent(t *testing.T) []byte {
+	return zstdBytes(t, decompressTestContent)
+}
+
+func zstdBytes(t *testing.T, content string) []byte {
+	buf := bytes.Buffer{}
+	w, err := zstd.NewWriter(&buf)
+	assert.Nil(t, err)
+	_, err = w.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func bzip2Content(t *testing.T) []byte {
+	// the standard library doesn't provide a bzip2 writer
+	bts, err := hex.DecodeString("425a683931415926535989695b68000007590000104000380002252000223d406420c988abd3063128678bb9229c284844b4adb400")
+	assert.Nil(t, err)
+	return bts
+}
+
+func TestNewDecompressingReader(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       []byte
+		compression Compression
+	}{
+		{name: "plain", input: []byte(decompressTestContent), compression: CompressionNone},
+		{name: "gzip", input: gzipContent(t), compression: CompressionGzip},
+		{name: "zstd", input: zstdContent(t), compression: CompressionZstd},
+		{name: "bzip2", input: bzip2Content(t), compression: CompressionBzip2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, compression, err := NewDecompressingReader(bytes.NewReader(tc.input))
+			assert.Nil(t, err)
+			assert.Equal(t, tc.compression, compression)
+
+			content, err := io.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Equal(t, decompressTestContent, string(content))
+		})
+	}
+}
+
+func TestOpenFileForReadingCompressed(t *testing.T) {
+	file := t.TempDir() + "/archive.log.1"
+	err := os.WriteFile(file, gzipContent(t), 0644)
+	assert.Nil(t, err)
+
+	assert.True(t, IsCompressedFile(file))
+
+	r, size := OpenFileForReading(file)
+	assert.Equal(t, int64(len(gzipContent(t))), size)
+
+	lines := []string{}
+	LineCounterWithChannel(r, func(line Line, cancel func()) {
+		lines = append(lines, string(line.Line))
+	})
+	assert.Equal(t, []string{"line 1", "line 2", "line 3"}, lines)
+}
+
+func TestLineCounterWithChannelCompressed(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress func(t *testing.T, content string) []byte
+		content  string
+	}{
+		{name: "gzip", compress: gzipBytes, content: "line 1\nline 2\n"},
+		{name: "gzip without final newline", compress: gzipBytes, content: "line 1\nline 2"},
+		{name: "zstd", compress: zstdBytes, content: "line 1\nline 2\n"},
+		{name: "zstd without final newline", compress: zstdBytes, content: "line 1\nline 2"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			file := t.TempDir() + "/app.log"
+			assert.Nil(t, os.WriteFile(file, tc.compress(t, tc.content), 0644))
+
+			r, _ := OpenFileForReading(file)
+			lines := []string{}
+			LineCounterWithChannel(r, func(line Line, cancel func()) {
+				lines = append(lines, string(line.Line))
+			})
+			assert.Equal(t, []string{"line 1", "line 2"}, lines)
+		})
+	}
+}
@@ -43,14 +43,14 @@ func LineCounterWithChannel(r io.Reader, fn func(line Line, cancel func())) erro
 
 		if newlineIndex == -1 {
 
-			if i == bufferSize {
+			// a short read doesn't mean the end of the data (e.g. decompressing readers),
+			// keep reading until EOF is reported
+			if err != io.EOF {
 				continue
 			}
 
-			if err == io.EOF || (i == 0 || i < bufferSize) {
-				fn(Line{seq: seq, Line: previousLine}, cancel)
-				return nil
-			}
+			fn(Line{seq: seq, Line: previousLine}, cancel)
+			return nil
 		}
 
 		lines := bytes.Split(previousLine, []byte{'\n'})
@@ -62,13 +62,19 @@ func LineCounterWithChannel(r io.Reader, fn func(line Line, cancel func())) erro
 			fn(Line{seq: seq, Line: line}, cancel)
 		}
 
+		// data ending with a new line can be returned together with EOF (e.g. decompressing readers)
 		if err == io.EOF {
-			fn(Line{seq: seq, Line: previousLine}, cancel)
+			if len(previousLine) > 0 {
+				fn(Line{seq: seq, Line: previousLine}, cancel)
+			}
+			cancel()
 			return nil
 		}
 	}
 }
 
+// OpenFileForReadingWithProgress opens a file and decompresses it if needed,
+// the progress bar measures the bytes read from the file (compressed size)
 func OpenFileForReadingWithProgress(file string) (io.Reader, int64, *pb.ProgressBar) {
 	reader, err := os.Open(file)
 
@@ -78,9 +84,17 @@ func OpenFileForReadingWithProgress(file string) (io.Reader, int64, *pb.Progress
 
 	fi, _ := reader.Stat()
 	bar := pb.Full.Start64(fi.Size())
-	return bar.NewProxyReader(reader), fi.Size(), bar
+
+	r, _, err := NewDecompressingReader(bar.NewProxyReader(reader))
+	if err != nil {
+		panic(err)
+	}
+
+	return r, fi.Size(), bar
 }
 
+// OpenFileForReading opens a file and decompresses it if needed,
+// the returned size is the size of the file on disk
 func OpenFileForReading(file string) (io.Reader, int64) {
 	reader, err := os.Open(file)
 
@@ -89,7 +103,13 @@ func OpenFileForReading(file string) (io.Reader, int64) {
 	}
 
 	fi, _ := reader.Stat()
-	return reader, fi.Size()
+
+	r, _, err := NewDecompressingReader(reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return r, fi.Size()
 }
 
 func LineCounter(r io.Reader) (int, error) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -44,3 +45,14 @@ func TestLineCounterWithChannel(t *testing.T) {
 	}
 
 }
+
+func TestLineCounterWithChannelShortReads(t *testing.T) {
+	line := strings.Repeat("a", 100_000)
+	c := 0
+	LineCounterWithChannel(iotest.HalfReader(bytes.NewBufferString(line+"\n"+line)), func(l Line, cancel func()) {
+		c++
+		assert.Equal(t, line, string(l.Line))
+	})
+
+	assert.Equal(t, 2, c)
+}
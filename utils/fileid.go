@@ -0,0 +1,19 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileIdentity returns a device and inode numbers of a file,
+// zeros are returned when the platform doesn't expose them
+func FileIdentity(fi os.FileInfo) (uint64, uint64) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+
+	return uint64(st.Dev), uint64(st.Ino)
+}
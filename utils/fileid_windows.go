@@ -0,0 +1,9 @@
+package utils
+
+import "os"
+
+// FileIdentity returns a device and inode numbers of a file,
+// these are not exposed through os.FileInfo on Windows so zeros are returned
+func FileIdentity(fi os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
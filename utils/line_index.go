@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// extension of a sidecar file holding an index of line offsets
+const LINE_INDEX_EXT = ".ldyidx"
+
+const LINE_INDEX_DEFAULT_INTERVAL = 1000
+
+var lineIndexMagic = [8]byte{'L', 'D', 'Y', 'I', 'D', 'X', '2', '\n'}
+
+// a number of bytes from the beginning of a file used to recognize that a file has been replaced
+const lineIndexHeadSize = 4096
+
+// a value of a sampled time when there was no line with a time so far
+const lineIndexNoTime = math.MinInt64
+
+const lineIndexFlagTimes = 1
+
+// LineIndex holds offsets of every `Interval`-th line of a file (starting with the first line)
+// and optionally a time of the last line with a time at or before each of these lines,
+// times can only be used by a search extracting them the same way (see TimesExtractedWith).
+// An index is stale when the file has been truncated or replaced, lines appended
+// after the index was built are not indexed but the index can still be used.
+type LineIndex struct {
+	Interval int
+	Size     int64  // size of the file when indexed
+	HeadHash uint64 // hash of the beginning of the file
+	Lines    int64  // number of indexed lines
+	Offsets  []int64
+	Times    []int64 // unix nanoseconds, nil when times are not indexed
+
+	TimeExtractor string // name of the extractor of times
+}
+
+var ErrLineIndexStale = errors.New("line index is stale")
+
+func LineIndexPath(file string) string {
+	return file + LINE_INDEX_EXT
+}
+
+func fileHeadHash(r io.ReaderAt, size int64) (uint64, error) {
+	head := make([]byte, min(size, lineIndexHeadSize))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	h.Write(head)
+	return h.Sum64(), nil
+}
+
+// BuildLineIndex indexes offsets of every `interval`-th line of a plain (not compressed) file,
+// times of lines are indexed when an extractor is given
+func BuildLineIndex(file string, interval int, extractor *TimeExtractor) (*LineIndex, error) {
+	if interval <= 0 {
+		return nil, errors.New("interval must be greater than 0")
+	}
+	if IsCompressedFile(file) {
+		return nil, errors.New("compressed files can't be indexed")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &LineIndex{Interval: interval, Size: fi.Size()}
+	idx.HeadHash, err = fileHeadHash(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	withTimes := extractor != nil
+	if withTimes {
+		idx.Times = []int64{}
+		idx.TimeExtractor = extractor.Name
+	}
+
+	bar := pb.Full.Start64(fi.Size())
+	r := bufio.NewReaderSize(bar.NewProxyReader(io.LimitReader(f, fi.Size())), 64*1024)
+	defer bar.Finish()
+
+	var offset int64
+	var lastTime int64 = lineIndexNoTime
+	head := []byte{}
+	for {
+		start := offset
+		line, err := r.ReadSlice('\n')
+		offset += int64(len(line))
+		if withTimes {
+			// only the beginning of a line longer than the buffer is used to find a time
+			head = append(head[:0], line...)
+		}
+		for err == bufio.ErrBufferFull {
+			line, err = r.ReadSlice('\n')
+			offset += int64(len(line))
+		}
+		if offset == start {
+			break
+		}
+
+		if withTimes {
+			if ts, ok := extractor.Extract(head); ok {
+				lastTime = ts.UnixNano()
+			}
+		}
+
+		if idx.Lines%int64(interval) == 0 {
+			idx.Offsets = append(idx.Offsets, start)
+			if withTimes {
+				idx.Times = append(idx.Times, lastTime)
+			}
+		}
+		idx.Lines++
+
+		if err != nil {
+			break
+		}
+	}
+
+	return idx, nil
+}
+
+// Write saves the index atomically next to the file
+func (idx *LineIndex) Write(file string) error {
+	path := LineIndexPath(file)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	var flags uint32
+	if idx.Times != nil {
+		flags |= lineIndexFlagTimes
+	}
+
+	header := []any{lineIndexMagic, flags, uint32(idx.Interval), idx.Size, idx.HeadHash, idx.Lines, uint64(len(idx.Offsets))}
+	for _, v := range header {
+		binary.Write(w, binary.LittleEndian, v)
+	}
+	binary.Write(w, binary.LittleEndian, uint32(len(idx.TimeExtractor)))
+	w.WriteString(idx.TimeExtractor)
+	for i, offset := range idx.Offsets {
+		binary.Write(w, binary.LittleEndian, offset)
+		if idx.Times != nil {
+			binary.Write(w, binary.LittleEndian, idx.Times[i])
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// ReadLineIndex reads an index of a file, ErrLineIndexStale is returned
+// when the file has been truncated or replaced since the index was built
+func ReadLineIndex(file string) (*LineIndex, error) {
+	f, err := os.Open(LineIndexPath(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var magic [8]byte
+	var flags, interval uint32
+	var count uint64
+	idx := &LineIndex{}
+
+	for _, v := range []any{&magic, &flags, &interval, &idx.Size, &idx.HeadHash, &idx.Lines, &count} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	if magic != lineIndexMagic {
+		return nil, errors.New("not a line index file")
+	}
+
+	var nameLen uint32
+	if err := binary.Read(r, binary.LittleEndian, &nameLen); err != nil {
+		return nil, err
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	idx.TimeExtractor = string(name)
+
+	idx.Interval = int(interval)
+	idx.Offsets = make([]int64, count)
+	if flags&lineIndexFlagTimes != 0 {
+		idx.Times = make([]int64, count)
+	}
+	for i := range idx.Offsets {
+		if err := binary.Read(r, binary.LittleEndian, &idx.Offsets[i]); err != nil {
+			return nil, err
+		}
+		if idx.Times != nil {
+			if err := binary.Read(r, binary.LittleEndian, &idx.Times[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	fi, err := data.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < idx.Size {
+		return nil, ErrLineIndexStale
+	}
+	hash, err := fileHeadHash(data, idx.Size)
+	if err != nil {
+		return nil, err
+	}
+	if hash != idx.HeadHash {
+		return nil, ErrLineIndexStale
+	}
+
+	return idx, nil
+}
+
+// LoadLineIndex returns an index of a file if it exists and is not stale
+func LoadLineIndex(file string) (*LineIndex, bool) {
+	idx, err := ReadLineIndex(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Logger.WithField("path", file).WithField("error", err.Error()).Debug("Line index not used")
+		}
+		return nil, false
+	}
+
+	return idx, true
+}
+
+// LineOffset returns an offset of the closest indexed line at or before the line
+// with a given number (counted from 0) and the number of that line
+func (idx *LineIndex) LineOffset(line int64) (int64, int64) {
+	if line <= 0 || len(idx.Offsets) == 0 {
+		return 0, 0
+	}
+
+	i := min(line/int64(idx.Interval), int64(len(idx.Offsets)-1))
+	return idx.Offsets[i], i * int64(idx.Interval)
+}
+
+// TimesExtractedWith reports whether indexed times were extracted the same way as with the extractor,
+// times extracted differently (e.g. with another format) can't be used to search for a time
+func (idx *LineIndex) TimesExtractedWith(extractor *TimeExtractor) bool {
+	return idx.Times != nil && idx.TimeExtractor == extractor.Name
+}
+
+// SortedByTime reports whether indexed times don't decrease
+func (idx *LineIndex) SortedByTime() bool {
+	if idx.Times == nil {
+		return false
+	}
+
+	for i := 1; i < len(idx.Times); i++ {
+		if idx.Times[i] < idx.Times[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// TimeOffset returns an offset from which lines of a file sorted by time have to be scanned
+// to find the first line with a time equal or after the target
+func (idx *LineIndex) TimeOffset(target time.Time) int64 {
+	if len(idx.Times) == 0 {
+		return 0
+	}
+
+	t := target.UnixNano()
+	// the first indexed line with the last time before it not older than the target
+	i := sort.Search(len(idx.Times), func(i int) bool {
+		return idx.Times[i] != lineIndexNoTime && idx.Times[i] >= t
+	})
+	if i == 0 {
+		return 0
+	}
+	return idx.Offsets[i-1]
+}
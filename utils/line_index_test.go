@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineIndex(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	content := strings.Builder{}
+	offsets := []int64{}
+	for i := 0; i < 1000; i++ {
+		offsets = append(offsets, int64(content.Len()))
+		if i%10 == 5 {
+			content.WriteString("no time " + strings.Repeat("x", 100_000) + "\n") // longer than a read buffer
+			continue
+		}
+		content.WriteString(start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339) + " line " + strconv.Itoa(i) + "\n")
+	}
+
+	file := t.TempDir() + "/app.log"
+	assert.Nil(t, os.WriteFile(file, []byte(content.String()), 0644))
+
+	_, ok := LoadLineIndex(file)
+	assert.False(t, ok)
+
+	built, err := BuildLineIndex(file, 100, AnyTimeExtractor())
+	assert.Nil(t, err)
+	assert.Nil(t, built.Write(file))
+
+	idx, ok := LoadLineIndex(file)
+	assert.True(t, ok)
+	assert.Equal(t, built, idx)
+	assert.Equal(t, int64(1000), idx.Lines)
+	assert.Equal(t, 10, len(idx.Offsets))
+	assert.True(t, idx.SortedByTime())
+	assert.True(t, idx.TimesExtractedWith(AnyTimeExtractor()))
+	assert.False(t, idx.TimesExtractedWith(LayoutTimeExtractor(time.RFC3339, 0)))
+
+	offset, line := idx.LineOffset(250)
+	assert.Equal(t, int64(200), line)
+	assert.Equal(t, offsets[200], offset)
+
+	offset, line = idx.LineOffset(5000)
+	assert.Equal(t, int64(900), line)
+	assert.Equal(t, offsets[900], offset)
+
+	assert.Equal(t, offsets[300], idx.TimeOffset(start.Add(350*time.Minute)))
+	assert.Equal(t, int64(0), idx.TimeOffset(start.Add(-time.Hour)))
+	assert.Equal(t, offsets[900], idx.TimeOffset(start.Add(10_000*time.Minute)))
+
+	// appended lines don't make the index stale
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	f.WriteString("appended\n")
+	f.Close()
+	_, ok = LoadLineIndex(file)
+	assert.True(t, ok)
+
+	assert.Nil(t, os.WriteFile(file, []byte("replaced\n"), 0644))
+	_, err = ReadLineIndex(file)
+	assert.Equal(t, ErrLineIndexStale, err)
+}
@@ -14,11 +14,14 @@ func ProcessIncomingMessages(ch chan models.Message, appendToFile string, append
 
 // ProcessIncomingMessagesWithRotation processes incoming messages with optional log rotation
 // maxSize: maximum size of the log file in bytes before rotation (0 = no rotation)
+// Once the input channel is closed and drained, the file is closed and then the returned channel is closed.
 func ProcessIncomingMessagesWithRotation(ch chan models.Message, appendToFile string, appendToFileRaw bool, maxSize int64, maxBackups int) chan models.Message {
 	mainChan := make(chan models.Message, 1000)
 
 	if appendToFile != "" {
 		go func() {
+			defer close(mainChan)
+
 			var writer io.WriteCloser
 			var err error
 
@@ -45,15 +48,17 @@ func ProcessIncomingMessagesWithRotation(ch chan models.Message, appendToFile st
 			rewriteMessagesToWriter(ch, mainChan, writer, appendToFileRaw)
 		}()
 	} else {
-		go rewriteMessages(ch, mainChan)
+		go func() {
+			defer close(mainChan)
+			rewriteMessages(ch, mainChan)
+		}()
 	}
 
 	return mainChan
 }
 
 func rewriteMessagesToWriter(source chan models.Message, dest chan models.Message, f io.Writer, raw bool) {
-	for {
-		msg := <-source
+	for msg := range source {
 		toSerialize := msg
 		var bts []byte
 		if raw {
@@ -71,8 +76,7 @@ func rewriteMessagesToWriter(source chan models.Message, dest chan models.Messag
 }
 
 func rewriteMessages(source chan models.Message, dest chan models.Message) {
-	for {
-		msg := <-source
+	for msg := range source {
 		dest <- msg
 	}
 }
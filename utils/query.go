@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// JSON fields that usually hold a level of a log message
+var levelJsonFields = []string{"level", "lvl", "severity", "log.level"}
+
+var levelAliases = map[string]string{
+	"warning":  "warn",
+	"err":      "error",
+	"critical": "fatal",
+	"crit":     "fatal",
+	"dbg":      "debug",
+	"trc":      "trace",
+}
+
+var queryFieldRegex = regexp.MustCompile(`^([A-Za-z0-9_.@-]+)(!=|!~|>=|<=|=|~|>|<)(.*)$`)
+
+// Query matches log lines, it consists of terms separated by spaces, all of them have to match:
+//
+//	field=value, field!=value     JSON field equal (or not) to a value, numbers are compared as numbers
+//	field>n, field>=n, field<n, field<=n
+//	field~regex, field!~regex     JSON field matching (or not) a regular expression
+//	/regex/                       raw line matching a regular expression
+//	level:error                   level from a JSON field (level, lvl, severity) or a word in a text line
+//	since:-2h, until:2024-05-01   time of a line (see ParseTimeExpression) within a range
+//	word                          raw line containing a word (case insensitive)
+//
+// Nested JSON fields are separated with a dot, values containing spaces can be quoted with `"`.
+// All field terms, negated ones included, match only lines having the field, so text lines never match them.
+// The syntax is used by `utils filter`, the export API and the library, filters in the UI have their own.
+type Query struct {
+	terms []queryTerm
+}
+
+type queryTerm struct {
+	match func(l *QueryLine) bool
+}
+
+// QueryLine is a line matched against a query, JSON and time are extracted
+// lazily and only once
+type QueryLine struct {
+	Raw []byte
+
+	json       *fastjson.Value
+	jsonParsed bool
+	ts         time.Time
+	hasTs      bool
+	tsParsed   bool
+}
+
+func NewQueryLine(raw []byte) *QueryLine {
+	return &QueryLine{Raw: raw}
+}
+
+// Json returns a line parsed as JSON or nil if the line is not a JSON object
+func (l *QueryLine) Json() *fastjson.Value {
+	if !l.jsonParsed {
+		l.jsonParsed = true
+		trimmed := bytes.TrimSpace(l.Raw)
+		if len(trimmed) > 0 && trimmed[0] == '{' {
+			if v, err := fastjson.ParseBytes(trimmed); err == nil {
+				l.json = v
+			}
+		}
+	}
+	return l.json
+}
+
+// Time returns a time of a line, see ParseLineTime
+func (l *QueryLine) Time() (time.Time, bool) {
+	if !l.tsParsed {
+		l.tsParsed = true
+		l.ts, l.hasTs = ParseLineTime(bytes.TrimSpace(l.Raw))
+	}
+	return l.ts, l.hasTs
+}
+
+// Field returns a value of a JSON field as a string and whether it was found
+func (l *QueryLine) Field(path string) (string, bool) {
+	v := l.Json()
+	if v == nil {
+		return "", false
+	}
+
+	fv := v.Get(strings.Split(path, ".")...)
+	if fv == nil {
+		return "", false
+	}
+
+	return JsonValueString(fv), true
+}
+
+// JsonValueString returns a string value as is and other values as JSON
+func JsonValueString(v *fastjson.Value) string {
+	if v.Type() == fastjson.TypeString {
+		return string(v.GetStringBytes())
+	}
+	return string(v.MarshalTo(nil))
+}
+
+// ParseQuery parses a query, relative times in `since:` and `until:` terms are relative to now
+func ParseQuery(q string, now time.Time) (*Query, error) {
+	tokens, err := tokenizeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{}
+	for _, token := range tokens {
+		term, err := parseQueryTerm(token, now)
+		if err != nil {
+			return nil, err
+		}
+		query.terms = append(query.terms, term)
+	}
+
+	return query, nil
+}
+
+// Match reports whether a raw line matches all of the terms of the query
+func (q *Query) Match(line []byte) bool {
+	return q.MatchLine(NewQueryLine(line))
+}
+
+func (q *Query) MatchLine(l *QueryLine) bool {
+	for _, term := range q.terms {
+		if !term.match(l) {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenizeQuery(q string) ([]string, error) {
+	tokens := []string{}
+	current := strings.Builder{}
+	inQuotes := false
+	hasToken := false
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasToken = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				hasToken = false
+			}
+		default:
+			current.WriteRune(r)
+			hasToken = true
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in query: %s", q)
+	}
+	if hasToken {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens, nil
+}
+
+func parseQueryTerm(token string, now time.Time) (queryTerm, error) {
+	if len(token) >= 2 && strings.HasPrefix(token, "/") && strings.HasSuffix(token, "/") {
+		re, err := regexp.Compile(token[1 : len(token)-1])
+		if err != nil {
+			return queryTerm{}, err
+		}
+		return queryTerm{match: func(l *QueryLine) bool {
+			return re.Match(l.Raw)
+		}}, nil
+	}
+
+	if level, ok := strings.CutPrefix(token, "level:"); ok {
+		return levelTerm(level), nil
+	}
+
+	if expr, ok := strings.CutPrefix(token, "since:"); ok {
+		since, err := ParseTimeExpression(expr, now)
+		if err != nil {
+			return queryTerm{}, err
+		}
+		return queryTerm{match: func(l *QueryLine) bool {
+			ts, ok := l.Time()
+			return ok && !ts.Before(since)
+		}}, nil
+	}
+
+	if expr, ok := strings.CutPrefix(token, "until:"); ok {
+		until, err := ParseTimeExpression(expr, now)
+		if err != nil {
+			return queryTerm{}, err
+		}
+		return queryTerm{match: func(l *QueryLine) bool {
+			ts, ok := l.Time()
+			return ok && !ts.After(until)
+		}}, nil
+	}
+
+	if m := queryFieldRegex.FindStringSubmatch(token); m != nil {
+		return fieldTerm(m[1], m[2], m[3])
+	}
+
+	word := []byte(strings.ToLower(token))
+	return queryTerm{match: func(l *QueryLine) bool {
+		return bytes.Contains(bytes.ToLower(l.Raw), word)
+	}}, nil
+}
+
+func fieldTerm(field string, op string, value string) (queryTerm, error) {
+	if op == "~" || op == "!~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return queryTerm{}, err
+		}
+		return queryTerm{match: func(l *QueryLine) bool {
+			v, ok := l.Field(field)
+			return ok && re.MatchString(v) == (op == "~")
+		}}, nil
+	}
+
+	number, numErr := strconv.ParseFloat(value, 64)
+	isNumber := numErr == nil
+
+	return queryTerm{match: func(l *QueryLine) bool {
+		v, ok := l.Field(field)
+		if !ok {
+			return false
+		}
+
+		cmp := strings.Compare(v, value)
+		if isNumber {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				cmp = compareFloats(n, number)
+			}
+		}
+
+		switch op {
+		case "=":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "<":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}}, nil
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// NormalizeLevel lowercases a level and maps its common aliases, e.g. `WARNING` -> `warn`
+func NormalizeLevel(level string) string {
+	level = strings.ToLower(level)
+	if alias, ok := levelAliases[level]; ok {
+		return alias
+	}
+	return level
+}
+
+// LineLevel returns a level of a line taken from a JSON field,
+// for text lines the first word matching a known level is used
+func LineLevel(l *QueryLine) (string, bool) {
+	if l.Json() != nil {
+		for _, field := range levelJsonFields {
+			if v, ok := l.Field(field); ok {
+				return NormalizeLevel(v), true
+			}
+		}
+		return "", false
+	}
+
+	if m := textLevelRegex.Find(l.Raw); m != nil {
+		return NormalizeLevel(string(m)), true
+	}
+	return "", false
+}
+
+var textLevelRegex = regexp.MustCompile(`(?i)\b(trace|trc|debug|dbg|info|warn|warning|error|err|fatal|critical|crit|panic)\b`)
+
+func levelTerm(level string) queryTerm {
+	level = NormalizeLevel(level)
+	return queryTerm{match: func(l *QueryLine) bool {
+		lv, ok := LineLevel(l)
+		return ok && lv == level
+	}}
+}
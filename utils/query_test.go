@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryMatch(t *testing.T) {
+	now := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+
+	jsonLine := `{"level":"WARNING","status":404,"msg":"not found","req":{"path":"/api/users","method":"GET"},"ts":"2024-05-01T22:12:09Z"}`
+	textLine := "2024-05-01T10:00:00Z ERROR payment failed for user 42"
+
+	tests := []struct {
+		query    string
+		line     string
+		expected bool
+	}{
+		{query: "status=404", line: jsonLine, expected: true},
+		{query: "status!=404", line: jsonLine, expected: false},
+		{query: "status>=400 status<500", line: jsonLine, expected: true},
+		{query: "status>1000", line: jsonLine, expected: false},
+		{query: "req.method=GET", line: jsonLine, expected: true},
+		{query: "req.path~^/api/", line: jsonLine, expected: true},
+		{query: "req.path!~^/api/", line: jsonLine, expected: false},
+		{query: `msg="not found"`, line: jsonLine, expected: true},
+		{query: "missing=1", line: jsonLine, expected: false},
+		{query: "missing!=1", line: jsonLine, expected: false},
+		{query: "missing!~1", line: jsonLine, expected: false},
+		{query: "status!=500", line: jsonLine, expected: true},
+		{query: "status!=500", line: textLine, expected: false},
+		{query: "status!=500", line: "", expected: false},
+		{query: "level:warn", line: jsonLine, expected: true},
+		{query: "level:error", line: jsonLine, expected: false},
+		{query: "level:error", line: textLine, expected: true},
+		{query: "since:2024-05-01T22:00:00Z", line: jsonLine, expected: true},
+		{query: "since:-1h", line: jsonLine, expected: false},
+		{query: "since:-1d until:2024-05-01T12:00:00Z", line: textLine, expected: true},
+		{query: `"/user \d+/"`, line: textLine, expected: true},
+		{query: "PAYMENT", line: textLine, expected: true},
+		{query: "payment refund", line: textLine, expected: false},
+		{query: "status=404", line: textLine, expected: false},
+		{query: "", line: textLine, expected: true},
+	}
+
+	for _, tc := range tests {
+		q, err := ParseQuery(tc.query, now)
+		assert.Nil(t, err, tc.query)
+		assert.Equal(t, tc.expected, q.Match([]byte(tc.line)), tc.query)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{`msg="foo`, "/[/", "msg~[", "since:sometime"} {
+		_, err := ParseQuery(query, time.Now())
+		assert.NotNil(t, err, query)
+	}
+}
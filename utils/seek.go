@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+const seekChunkSize = 64 * 1024
+
+// below this distance binary search switches to a linear scan
+const searchLinearThreshold = 16 * 1024
+
+// SeekLastLines returns an offset at which the last n lines of the data start,
+// the data is read backwards from the end so only the tail of a file is touched
+func SeekLastLines(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+
+	end := size
+	buf := make([]byte, seekChunkSize)
+	lines := 0
+	skipTrailing := true
+
+	for end > 0 {
+		start := end - seekChunkSize
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := buf[:end-start]
+		if _, err := r.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				skipTrailing = false
+				continue
+			}
+
+			// a new line character ending the data doesn't start a new line
+			if skipTrailing && start+int64(i) == size-1 {
+				continue
+			}
+
+			lines++
+			if lines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+
+		end = start
+	}
+
+	return 0, nil
+}
+
+// ReadLineAt reads a line starting at the offset and returns it (without a new line character)
+// together with an offset of the next line
+func ReadLineAt(r io.ReaderAt, offset int64, size int64) ([]byte, int64, error) {
+	line := []byte{}
+	buf := make([]byte, 4096)
+
+	for offset < size {
+		n, err := r.ReadAt(buf, offset)
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return line, offset, err
+		}
+
+		idx := bytes.IndexByte(buf[:n], '\n')
+		if idx >= 0 {
+			line = append(line, buf[:idx]...)
+			return line, offset + int64(idx) + 1, nil
+		}
+
+		line = append(line, buf[:n]...)
+		offset += int64(n)
+	}
+
+	return line, size, nil
+}
+
+// LineStartAfter returns an offset of the first line starting at or after the offset
+func LineStartAfter(r io.ReaderAt, offset int64, size int64) (int64, error) {
+	if offset <= 0 {
+		return 0, nil
+	}
+
+	// a line starts at the offset when it's preceded by a new line character
+	_, next, err := ReadLineAt(r, offset-1, size)
+	return next, err
+}
+
+// SearchFileByTime finds an offset of the first line with a time equal or after the target,
+// the data is expected to be sorted by time. Lines without a recognizable time are skipped.
+// Size of the data is returned when there is no such line.
+func SearchFileByTime(r io.ReaderAt, size int64, target time.Time, extract func(line []byte) (time.Time, bool)) (int64, error) {
+	// all of the lines with time before `lo` are older than the target
+	lo, hi := int64(0), size
+
+	for hi-lo > searchLinearThreshold {
+		mid := lo + (hi-lo)/2
+		start, err := LineStartAfter(r, mid, size)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi {
+			// a single long line spans the rest of the range
+			break
+		}
+
+		found := false
+		for off := start; off < hi; {
+			line, next, err := ReadLineAt(r, off, size)
+			if err != nil {
+				return 0, err
+			}
+
+			if ts, ok := extract(line); ok {
+				found = true
+				if ts.Before(target) {
+					lo = next
+				} else {
+					hi = off
+				}
+				break
+			}
+			off = next
+		}
+
+		if !found {
+			hi = start
+		}
+	}
+
+	for off := lo; off < size; {
+		line, next, err := ReadLineAt(r, off, size)
+		if err != nil {
+			return 0, err
+		}
+
+		if ts, ok := extract(line); ok && !ts.Before(target) {
+			return off, nil
+		}
+		off = next
+	}
+
+	return size, nil
+}
+
+// IsSortedByTime samples a few lines at evenly spaced offsets and checks whether their times
+// don't decrease, lines without a recognizable time are skipped
+func IsSortedByTime(r io.ReaderAt, size int64, samples int, extract func(line []byte) (time.Time, bool)) (bool, error) {
+	var prev time.Time
+
+	for i := 0; i < samples; i++ {
+		start, err := LineStartAfter(r, size*int64(i)/int64(samples), size)
+		if err != nil {
+			return false, err
+		}
+
+		// compare times of a few consecutive lines
+		for off, n := start, 0; off < size && n < 10; n++ {
+			line, next, err := ReadLineAt(r, off, size)
+			if err != nil {
+				return false, err
+			}
+
+			if ts, ok := extract(line); ok {
+				if ts.Before(prev) {
+					return false, nil
+				}
+				prev = ts
+			}
+			off = next
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekLastLines(t *testing.T) {
+
+	tests := []struct {
+		input    string
+		lines    int
+		expected string
+	}{
+		{input: "a\nb\nc\n", lines: 2, expected: "b\nc\n"},
+		{input: "a\nb\nc", lines: 2, expected: "b\nc"},
+		{input: "a\nb\nc\n", lines: 5, expected: "a\nb\nc\n"},
+		{input: "a\nb\nc\n", lines: 0, expected: ""},
+		{input: "a\n\n\n", lines: 2, expected: "\n\n"},
+		{input: "", lines: 2, expected: ""},
+	}
+
+	for _, tc := range tests {
+		r := strings.NewReader(tc.input)
+		offset, err := SeekLastLines(r, int64(len(tc.input)), tc.lines)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, tc.input[offset:])
+	}
+}
+
+func TestSeekLastLinesLong(t *testing.T) {
+	sb := strings.Builder{}
+	for i := 0; i < 100_000; i++ {
+		sb.WriteString(fmt.Sprintf("line %d\n", i))
+	}
+	input := sb.String()
+
+	offset, err := SeekLastLines(strings.NewReader(input), int64(len(input)), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "line 99997\nline 99998\nline 99999\n", input[offset:])
+}
+
+func TestSearchFileByTime(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sb := strings.Builder{}
+	for i := 0; i < 50_000; i++ {
+		sb.WriteString(fmt.Sprintf("%s line %d\n", start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i))
+		if i%10 == 0 {
+			sb.WriteString("  a continuation line without a time\n")
+		}
+	}
+	input := sb.String()
+	r := strings.NewReader(input)
+	size := int64(len(input))
+
+	offset, err := SearchFileByTime(r, size, start.Add(30_000*time.Second), ParseLineTime)
+	assert.Nil(t, err)
+	line, _, err := ReadLineAt(r, offset, size)
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-05-01T08:20:00Z line 30000", string(line))
+
+	offset, err = SearchFileByTime(r, size, start.Add(-time.Hour), ParseLineTime)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	offset, err = SearchFileByTime(r, size, start.Add(100_000*time.Second), ParseLineTime)
+	assert.Nil(t, err)
+	assert.Equal(t, size, offset)
+}
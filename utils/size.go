@@ -40,3 +40,23 @@ func ParseRotateSize(sizeStr string) (int64, error) {
 
 	return size, nil
 }
+
+// FormatSize formats a number of bytes using the same units as ParseRotateSize, example: 1536 -> 1.5K
+func FormatSize(size int64) string {
+	units := []string{"K", "M", "G", "T"}
+	if size < 1024 {
+		return strconv.FormatInt(size, 10)
+	}
+
+	value := float64(size)
+	unit := ""
+	for _, u := range units {
+		if value < 1024 {
+			break
+		}
+		value /= 1024
+		unit = u
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + unit
+}
@@ -78,3 +78,19 @@ func TestParseRotateSize(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:                      "0",
+		1023:                   "1023",
+		1536:                   "1.5K",
+		250 * 1024 * 1024:      "250.0M",
+		3 * 1024 * 1024 * 1024: "3.0G",
+	}
+
+	for input, expected := range tests {
+		if got := FormatSize(input); got != expected {
+			t.Errorf("FormatSize(%d) = %s, want %s", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// JSON fields that usually hold a time of a log message
+var timestampJsonFields = []string{"ts", "time", "timestamp", "@timestamp", "date", "datetime", "t"}
+
+// TimeExtractor extracts a time from a log line in a specific way,
+// e.g. from a JSON field or a date in a specific format
+type TimeExtractor struct {
+	Name    string
+	extract func(line []byte) (time.Time, bool)
+}
+
+func (e *TimeExtractor) Extract(line []byte) (time.Time, bool) {
+	return e.extract(line)
+}
+
+type textTimeFormat struct {
+	name  string
+	regex *regexp.Regexp
+	parse func(s string) (time.Time, bool)
+}
+
+func layoutsParser(layouts ...string) func(s string) (time.Time, bool) {
+	return func(s string) (time.Time, bool) {
+		for _, layout := range layouts {
+			if ts, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return ts, true
+			}
+		}
+		return time.Time{}, false
+	}
+}
+
+// formats of dates that are searched for anywhere in a line
+var textTimeFormats = []textTimeFormat{
+	{
+		// e.g. 2024-05-01T22:12:09.123Z or 2024-05-01 22:12:09,123+02:00
+		name:  "iso8601",
+		regex: regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}([.,]\d+)?(Z|[+-]\d{2}:?\d{2})?`),
+		parse: parseIsoTimestamp,
+	},
+	{
+		// e.g. 01/May/2024:22:12:09 +0200 (common log format)
+		name:  "clf",
+		regex: regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`),
+		parse: layoutsParser("02/Jan/2006:15:04:05 -0700"),
+	},
+	{
+		// e.g. Wed, 01 May 2024 22:12:09 GMT
+		name:  "rfc1123",
+		regex: regexp.MustCompile(`[A-Z][a-z]{2}, \d{2} [A-Z][a-z]{2} \d{4} \d{2}:\d{2}:\d{2} ([A-Z]{3,4}|[+-]\d{4})`),
+		parse: layoutsParser(time.RFC1123, time.RFC1123Z),
+	},
+	{
+		// e.g. 05/01/2024 22:12:09.123
+		name:  "us-date",
+		regex: regexp.MustCompile(`\d{2}/\d{2}/\d{4} \d{2}:\d{2}:\d{2}(\.\d+)?`),
+		parse: layoutsParser("01/02/2006 15:04:05.999999999"),
+	},
+	{
+		// e.g. May  1 22:12:09 (syslog), the year is not present
+		name:  "syslog",
+		regex: regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`),
+		parse: parseSyslogTimestamp,
+	},
+	{
+		// unix timestamp in seconds or milliseconds at the beginning of a line
+		name:  "epoch",
+		regex: regexp.MustCompile(`^\[?(\d{13}|\d{10}(\.\d+)?)\b`),
+		parse: parseEpoch,
+	},
+}
+
+// ParseLineTime extracts a time from a log line, JSON lines are checked for common time fields
+// and text lines are searched for a date in one of the common formats. Dates without a timezone are
+// considered to be in the local time zone.
+func ParseLineTime(line []byte) (time.Time, bool) {
+	if len(line) > 0 && line[0] == '{' {
+		if ts, ok := parseJsonLineTime(line, timestampJsonFields); ok {
+			return ts, true
+		}
+	}
+
+	for _, format := range textTimeFormats {
+		if ts, ok := extractTextTime(line, format); ok {
+			return ts, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// AnyTimeExtractor extracts a time from a line trying all of the supported formats,
+// it's slower than an extractor for a specific format
+func AnyTimeExtractor() *TimeExtractor {
+	return &TimeExtractor{Name: "any", extract: ParseLineTime}
+}
+
+// JsonFieldTimeExtractor extracts a time from a JSON field, nested fields are separated with a dot
+func JsonFieldTimeExtractor(path string) *TimeExtractor {
+	return &TimeExtractor{
+		Name: "json:" + path,
+		extract: func(line []byte) (time.Time, bool) {
+			return parseJsonLineTime(line, []string{path})
+		},
+	}
+}
+
+// LayoutTimeExtractor parses a time in a Go layout at a fixed offset of a line
+func LayoutTimeExtractor(layout string, offset int) *TimeExtractor {
+	return &TimeExtractor{
+		Name: "layout:" + strconv.Itoa(offset) + ":" + layout,
+		extract: func(line []byte) (time.Time, bool) {
+			if offset < 0 || offset+len(layout) > len(line) {
+				return time.Time{}, false
+			}
+			t, err := time.Parse(layout, string(line[offset:offset+len(layout)]))
+			return t, err == nil && !t.IsZero()
+		},
+	}
+}
+
+func textTimeExtractor(format textTimeFormat) *TimeExtractor {
+	return &TimeExtractor{
+		Name: format.name,
+		extract: func(line []byte) (time.Time, bool) {
+			return extractTextTime(line, format)
+		},
+	}
+}
+
+// DetectTimeExtractor finds a way to extract a time that works for most of the sample lines
+func DetectTimeExtractor(lines [][]byte) (*TimeExtractor, bool) {
+	candidates := []*TimeExtractor{}
+	for _, field := range timestampJsonFields {
+		candidates = append(candidates, JsonFieldTimeExtractor(field))
+	}
+	for _, format := range textTimeFormats {
+		candidates = append(candidates, textTimeExtractor(format))
+	}
+
+	var best *TimeExtractor
+	bestCount := 0
+	for _, candidate := range candidates {
+		count := 0
+		for _, line := range lines {
+			if _, ok := candidate.Extract(line); ok {
+				count++
+			}
+		}
+
+		if count > bestCount {
+			best = candidate
+			bestCount = count
+		}
+	}
+
+	return best, best != nil
+}
+
+func extractTextTime(line []byte, format textTimeFormat) (time.Time, bool) {
+	match := format.regex.Find(line)
+	if match == nil {
+		return time.Time{}, false
+	}
+
+	return format.parse(string(match))
+}
+
+func parseJsonLineTime(line []byte, fields []string) (time.Time, bool) {
+	if len(line) == 0 || line[0] != '{' {
+		return time.Time{}, false
+	}
+
+	v, err := fastjson.ParseBytes(line)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	for _, field := range fields {
+		fv := v.Get(strings.Split(field, ".")...)
+		if fv == nil {
+			continue
+		}
+
+		switch fv.Type() {
+		case fastjson.TypeString:
+			if ts, ok := parseTimeString(string(fv.GetStringBytes())); ok {
+				return ts, true
+			}
+		case fastjson.TypeNumber:
+			return epochToTime(fv.GetFloat64()), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// parseTimeString parses a string that contains only a time in one of the supported formats
+func parseTimeString(s string) (time.Time, bool) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return epochToTime(n), true
+	}
+
+	for _, format := range textTimeFormats {
+		if match := format.regex.FindString(s); match == s {
+			if ts, ok := format.parse(s); ok {
+				return ts, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func parseIsoTimestamp(s string) (time.Time, bool) {
+	if len(s) < 19 {
+		return time.Time{}, false
+	}
+
+	// normalize a date-time separator and a comma used before fractional seconds
+	bts := []byte(s)
+	bts[10] = 'T'
+	if len(bts) > 19 && bts[19] == ',' {
+		bts[19] = '.'
+	}
+
+	return layoutsParser(
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+	)(string(bts))
+}
+
+func parseSyslogTimestamp(s string) (time.Time, bool) {
+	ts, err := time.ParseInLocation(time.Stamp, s, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+	ts = ts.AddDate(now.Year(), 0, 0)
+	// a date from December read in January belongs to the previous year
+	if ts.After(now.Add(24 * time.Hour)) {
+		ts = ts.AddDate(-1, 0, 0)
+	}
+
+	return ts, true
+}
+
+func parseEpoch(s string) (time.Time, bool) {
+	n, err := strconv.ParseFloat(strings.TrimPrefix(s, "["), 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return epochToTime(n), true
+}
+
+// epochToTime converts a unix timestamp in seconds or milliseconds to time
+func epochToTime(n float64) time.Time {
+	// timestamps in seconds will not reach this value for the next few hundred years
+	if n > 1e11 {
+		return time.UnixMilli(int64(n))
+	}
+
+	sec := int64(n)
+	return time.Unix(sec, int64((n-float64(sec))*1e9))
+}
+
+var relativeTimeRegex = regexp.MustCompile(`^([+-])(\d+(\.\d+)?)(ms|s|m|h|d|w)$`)
+
+// ParseTimeExpression parses a time given by a user: a relative expression like `-2h`, `+30m`, `-1d`,
+// `now`, a date in one of the supported formats, a date only (2024-05-01 or 20240501), a compact date
+// and time (20240501221209), a time only (22:12 or 22:12:09) which is considered to be today or a unix timestamp
+func ParseTimeExpression(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "now" {
+		return now, nil
+	}
+
+	if m := relativeTimeRegex.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.ParseFloat(m[2], 64)
+		units := map[string]time.Duration{
+			"ms": time.Millisecond,
+			"s":  time.Second,
+			"m":  time.Minute,
+			"h":  time.Hour,
+			"d":  24 * time.Hour,
+			"w":  7 * 24 * time.Hour,
+		}
+		d := time.Duration(n * float64(units[m[4]]))
+		if m[1] == "-" {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+
+	// compact dates are all digits too, they are checked before a unix timestamp
+	for _, layout := range []string{"20060102", "20060102150405"} {
+		if ts, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return ts, nil
+		}
+	}
+
+	if ts, ok := parseTimeString(s); ok {
+		return ts, nil
+	}
+
+	if ts, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return ts, nil
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05", "15:04:05.999999999"} {
+		if ts, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			y, m, d := now.In(time.Local).Date()
+			return ts.AddDate(y, int(m)-1, d-1), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized time: %s", s)
+}
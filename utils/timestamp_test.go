@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineTime(t *testing.T) {
+
+	tests := []struct {
+		line     string
+		expected time.Time
+		ok       bool
+	}{
+		{line: "2024-05-01T22:12:09Z foo", expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC), ok: true},
+		{line: "[2024-05-01 22:12:09.123+02:00] foo", expected: time.Date(2024, 5, 1, 20, 12, 9, 123_000_000, time.UTC), ok: true},
+		{line: "INFO 2024-05-01 22:12:09,500 foo", expected: time.Date(2024, 5, 1, 22, 12, 9, 500_000_000, time.Local), ok: true},
+		{line: `{"msg":"foo","time":"2024-05-01T22:12:09Z"}`, expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC), ok: true},
+		{line: `{"msg":"foo","ts":1714601529}`, expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC), ok: true},
+		{line: `{"msg":"foo","ts":1714601529123}`, expected: time.Date(2024, 5, 1, 22, 12, 9, 123_000_000, time.UTC), ok: true},
+		{line: `127.0.0.1 - - [01/May/2024:22:12:09 +0000] "GET / HTTP/1.1" 200`, expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC), ok: true},
+		{line: "Date: Wed, 01 May 2024 22:12:09 +0000", expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC), ok: true},
+		{line: "05/01/2024 22:12:09.250 foo", expected: time.Date(2024, 5, 1, 22, 12, 9, 250_000_000, time.Local), ok: true},
+		{line: "1714601529 foo", expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC), ok: true},
+		{line: "no time here", ok: false},
+	}
+
+	for _, tc := range tests {
+		ts, ok := ParseLineTime([]byte(tc.line))
+		assert.Equal(t, tc.ok, ok, tc.line)
+		if tc.ok {
+			assert.True(t, tc.expected.Equal(ts), "%s: expected %s, got %s", tc.line, tc.expected, ts)
+		}
+	}
+}
+
+func TestParseLineTimeSyslog(t *testing.T) {
+	ts, ok := ParseLineTime([]byte("Jan  2 03:04:05 host app[123]: foo"))
+	assert.True(t, ok)
+	assert.Equal(t, time.January, ts.Month())
+	assert.Equal(t, 2, ts.Day())
+	assert.Equal(t, 3, ts.Hour())
+	assert.False(t, ts.After(time.Now().Add(24*time.Hour)))
+}
+
+func TestJsonFieldTimeExtractor(t *testing.T) {
+	e := JsonFieldTimeExtractor("meta.ts")
+
+	ts, ok := e.Extract([]byte(`{"msg":"foo","meta":{"ts":"2024-05-01T22:12:09Z"}}`))
+	assert.True(t, ok)
+	assert.True(t, time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC).Equal(ts))
+
+	_, ok = e.Extract([]byte(`{"msg":"foo","ts":"2024-05-01T22:12:09Z"}`))
+	assert.False(t, ok)
+}
+
+func TestDetectTimeExtractor(t *testing.T) {
+	e, ok := DetectTimeExtractor([][]byte{
+		[]byte(`{"msg":"started at 2020-01-01 00:00:00","time":"2024-05-01T22:12:09Z"}`),
+		[]byte(`{"msg":"foo","time":"2024-05-01T22:12:10Z"}`),
+		[]byte(`not a json line`),
+	})
+	assert.True(t, ok)
+	assert.Equal(t, "json:time", e.Name)
+
+	e, ok = DetectTimeExtractor([][]byte{
+		[]byte(`127.0.0.1 - - [01/May/2024:22:12:09 +0000] "GET / HTTP/1.1" 200`),
+		[]byte(`127.0.0.1 - - [01/May/2024:22:12:10 +0000] "GET / HTTP/1.1" 200`),
+	})
+	assert.True(t, ok)
+	assert.Equal(t, "clf", e.Name)
+
+	_, ok = DetectTimeExtractor([][]byte{[]byte("foo"), []byte("bar")})
+	assert.False(t, ok)
+}
+
+func TestParseTimeExpression(t *testing.T) {
+	now := time.Date(2024, 5, 1, 22, 12, 9, 0, time.Local)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: "now", expected: now},
+		{expr: "-2h", expected: now.Add(-2 * time.Hour)},
+		{expr: "+30m", expected: now.Add(30 * time.Minute)},
+		{expr: "-1d", expected: now.Add(-24 * time.Hour)},
+		{expr: "-1.5s", expected: now.Add(-1500 * time.Millisecond)},
+		{expr: "2024-04-30T10:00:00Z", expected: time.Date(2024, 4, 30, 10, 0, 0, 0, time.UTC)},
+		{expr: "2024-04-30 10:00:00", expected: time.Date(2024, 4, 30, 10, 0, 0, 0, time.Local)},
+		{expr: "2024-04-30", expected: time.Date(2024, 4, 30, 0, 0, 0, 0, time.Local)},
+		{expr: "10:30", expected: time.Date(2024, 5, 1, 10, 30, 0, 0, time.Local)},
+		{expr: "1714601529", expected: time.Date(2024, 5, 1, 22, 12, 9, 0, time.UTC)},
+		{expr: "1714601529123", expected: time.Date(2024, 5, 1, 22, 12, 9, 123000000, time.UTC)},
+		{expr: "20240115", expected: time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)},
+		{expr: "20240115103000", expected: time.Date(2024, 1, 15, 10, 30, 0, 0, time.Local)},
+	}
+
+	for _, tc := range tests {
+		ts, err := ParseTimeExpression(tc.expr, now)
+		assert.Nil(t, err, tc.expr)
+		assert.True(t, tc.expected.Equal(ts), "%s: expected %s, got %s", tc.expr, tc.expected, ts)
+	}
+
+	_, err := ParseTimeExpression("yesterday-ish", now)
+	assert.NotNil(t, err)
+}